@@ -1,7 +1,7 @@
 package api
 
 import (
-	"backend/src/db"
+	"backend/src/store"
 	customTypes "backend/src/types"
 	"backend/src/utils"
 	"context"
@@ -9,12 +9,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
 
 	containerTypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
-	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 )
 
@@ -45,81 +43,67 @@ func WriteError(writer http.ResponseWriter, statusCode int, errmsg error) {
 	}
 }
 
-func HandleError(function customTypes.ApiFunction) http.HandlerFunc {
-	return func(writer http.ResponseWriter, request *http.Request) {
-		err := function(writer, request)
-		if err != nil {
-			fmt.Println("Server: Error ocurred: ", err.Error())
-			WriteError(writer, http.StatusBadRequest, err)
-		}
-	}
+// ApiError lets api functions choose the status code and headers of the error response
+type ApiError struct {
+	StatusCode int
+	Err        error
+	Header     http.Header
 }
 
-// middleware
-func JWTAuth(handlerFunc http.HandlerFunc) http.HandlerFunc {
-	return func(writer http.ResponseWriter, request *http.Request) {
+func (e *ApiError) Error() string {
+	return e.Err.Error()
+}
 
-		tokenString := request.Header.Get("xJwtToken")
+func (e *ApiError) Unwrap() error {
+	return e.Err
+}
 
-		token, err := ValidateJWT(tokenString)
+func NewApiError(statusCode int, message string) *ApiError {
+	return &ApiError{StatusCode: statusCode, Err: errors.New(message)}
+}
 
+func HandleError(function customTypes.ApiFunction) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		err := function(writer, request)
 		if err != nil {
-			err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "permission denied"})
-			if err != nil {
-				fmt.Println("Server: Error ocurred: ", err.Error())
+			if writeContextError(writer, err) {
+				return
 			}
-			return
-		}
 
-		if !token.Valid {
-			err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "permission denied"})
-			if err != nil {
-				fmt.Println("Server: Error ocurred: ", err.Error())
-			}
-			return
-		}
-
-		claims, _ := token.Claims.(jwt.MapClaims)
+			fmt.Println("Server: Error ocurred: ", err.Error())
 
-		reqID := request.Header.Get("ID")
+			var apiErr *ApiError
+			if errors.As(err, &apiErr) {
+				for key, values := range apiErr.Header {
+					writer.Header()[key] = values
+				}
 
-		if reqID != claims["ID"] {
-			err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "invalid token"})
-			if err != nil {
-				fmt.Println("Server: Error ocurred: ", err.Error())
+				WriteError(writer, apiErr.StatusCode, apiErr)
+				return
 			}
-			return
-		}
-
-		handlerFunc(writer, request)
-	}
-}
-
-func ValidateJWT(tokenString string) (*jwt.Token, error) {
-
-	secret := os.Getenv("JWT_SECRET")
-
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			WriteError(writer, http.StatusBadRequest, err)
 		}
-
-		return []byte(secret), nil
-	})
+	}
 }
 
-func CreateJWT(usrID string) (string, error) {
-	claims := &jwt.MapClaims{
-		"expiresAt": 15000,
-		"ID":        usrID,
+/*
+writeContextError answers requests whose database operation ran out of time, it returns false for other errors.
+Cancelled requests are only logged, the client is gone and they aren't database errors
+*/
+func writeContextError(writer http.ResponseWriter, err error) bool {
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("Server: Request cancelled: ", err.Error())
+		return true
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	secret := os.Getenv("JWT_SECRET")
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Println("Server: Database timeout: ", err.Error())
+		WriteError(writer, http.StatusGatewayTimeout, errors.New("database timeout"))
+		return true
+	}
 
-	return token.SignedString([]byte(secret))
+	return false
 }
 
 /*
@@ -132,7 +116,7 @@ func HandleGetBier(writer http.ResponseWriter, _ *http.Request) error {
 	return WriteJSON(writer, http.StatusOK, "Bier")
 }
 
-func HandleRegisterUser(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleRegisterUser(writer http.ResponseWriter, request *http.Request) error {
 	var userStruct customTypes.RegisterUserRequest
 	err := ParseJSON(request, &userStruct)
 
@@ -140,16 +124,33 @@ func HandleRegisterUser(writer http.ResponseWriter, request *http.Request) error
 		return err
 	}
 
-	err = db.RegisterUser(userStruct)
+	err = validatePassword(userStruct.Password, userStruct.Email)
 
 	if err != nil {
 		return err
 	}
 
+	newUser, err := a.Users.Register(request.Context(), userStruct)
+
+	if errors.Is(err, store.ErrEmailInUse) {
+		return &ApiError{StatusCode: http.StatusConflict, Err: err}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// the account exists at this point, the user can request a new link if the mail fails
+	err = a.sendVerificationMail(request.Context(), newUser.ID.String(), newUser.Email)
+
+	if err != nil {
+		fmt.Println("Server: Error sending verification mail: ", err.Error())
+	}
+
 	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully created user"})
 }
 
-func HandleLoginUser(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleLoginUser(writer http.ResponseWriter, request *http.Request) error {
 	var usr customTypes.LoginUserRequest
 	err := ParseJSON(request, &usr)
 
@@ -157,24 +158,32 @@ func HandleLoginUser(writer http.ResponseWriter, request *http.Request) error {
 		return err
 	}
 
-	var usrID string
-	usrID, err = db.LoginUser(usr)
+	ip := ClientIP(request)
+
+	err = a.checkLoginAllowed(request.Context(), usr.Email, ip)
 
 	if err != nil {
 		return err
 	}
 
-	// create jwt token when user logs in
-	tokenString, err := CreateJWT(usrID)
+	var usrID string
+	usrID, err = a.loginUser(request.Context(), usr)
+
+	if errors.Is(err, ErrEmailNotVerified) || errors.Is(err, ErrPasswordLoginDisabled) {
+		return &ApiError{StatusCode: http.StatusForbidden, Err: err}
+	}
 
 	if err != nil {
-		return errors.New("error while creating jwt token uuid: " + err.Error())
+		return a.loginFailed(request.Context(), usr.Email, ip, err)
 	}
 
-	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully Logged in", "X-JWT-Token": tokenString})
+	a.loginSucceeded(request.Context(), usr.Email, ip)
+
+	// create session and jwt token when user logs in
+	return a.finishLogin(writer, request, usrID, customTypes.USER, "X-JWT-Token", map[string]any{"message": "Sucessfully Logged in"})
 }
 
-func HandleEditUser(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleEditUser(writer http.ResponseWriter, request *http.Request) error {
 	userID := mux.Vars(request)["ID"]
 
 	if userID == "" {
@@ -189,25 +198,44 @@ func HandleEditUser(writer http.ResponseWriter, request *http.Request) error {
 		return errors.New("unable to parse json" + err.Error())
 	}
 
-	var usrID string
+	oldUsr, err := a.Users.GetByID(request.Context(), userID)
 
-	usrID, err = db.EditPerson(customTypes.USER, userID, &editUsr, nil)
+	if err != nil {
+		return err
+	}
+
+	err = a.Users.Edit(request.Context(), userID, &editUsr)
+
+	if errors.Is(err, store.ErrEmailInUse) {
+		return &ApiError{StatusCode: http.StatusConflict, Err: err}
+	}
 
 	if err != nil {
 		return err
 	}
 
-	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully updated user  " + usrID})
+	// the new email is unverified until the link sent to it was opened
+	email := store.NormalizeEmail(editUsr.Email)
+
+	if email != oldUsr.Email {
+		err = a.sendVerificationMail(request.Context(), userID, email)
+
+		if err != nil {
+			fmt.Println("Server: Error sending verification mail: ", err.Error())
+		}
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully updated user  " + userID})
 }
 
-func HandleGetUserByID(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleGetUserByID(writer http.ResponseWriter, request *http.Request) error {
 	reqID := mux.Vars(request)["ID"]
 
 	if reqID == "" {
 		return errors.New("invalid ID")
 	}
 
-	usr, err := db.GetUserByID(reqID)
+	usr, err := a.Users.GetByID(request.Context(), reqID)
 
 	if err != nil {
 		return err
@@ -216,7 +244,10 @@ func HandleGetUserByID(writer http.ResponseWriter, request *http.Request) error
 	return WriteJSON(writer, http.StatusOK, usr)
 }
 
-func HandleLoginAdmin(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleLoginAdmin(writer http.ResponseWriter, request *http.Request) error {
+	if !adminPasswordLoginEnabled() {
+		return NewApiError(http.StatusForbidden, "password login disabled, use the identity provider")
+	}
 
 	var adm customTypes.LoginAdminRequest
 	err := ParseJSON(request, &adm)
@@ -225,32 +256,29 @@ func HandleLoginAdmin(writer http.ResponseWriter, request *http.Request) error {
 		return err
 	}
 
-	ip := request.RemoteAddr
+	ip := ClientIP(request)
 
-	blocked := utils.TrackLoginAttempt(ip, adm.Email)
-
-	if blocked {
-		return errors.New("too many requests")
-	}
-
-	var admID string
-	admID, err = db.LoginAdmin(adm)
+	err = a.checkLoginAllowed(request.Context(), adm.Email, ip)
 
 	if err != nil {
 		return err
 	}
 
-	// create jwt token when admin logs in
-	tokenString, err := CreateJWT(admID)
+	var admID string
+	admID, err = a.Admins.Authenticate(request.Context(), adm.Email, adm.Password)
 
 	if err != nil {
-		return errors.New("error while creating jwt token uuid: " + err.Error())
+		return a.loginFailed(request.Context(), adm.Email, ip, err)
 	}
 
-	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully Logged in", "xJwtToken": tokenString, "adminId": admID})
+	a.loginSucceeded(request.Context(), adm.Email, ip)
+
+	// create jwt token when admin logs in, admins with mfa need a second step
+	return a.startAdminLogin(writer, request, admID)
 }
 
-func HandleValidateAdminJWT(writer http.ResponseWriter, request *http.Request) error {
+// HandleValidateAdminJWT tells the dashboard whether the token belongs to a logged in admin
+func (a *API) HandleValidateAdminJWT(writer http.ResponseWriter, request *http.Request) error {
 	var jwtRequest customTypes.ValidateJWTRequest
 	err := ParseJSON(request, &jwtRequest)
 
@@ -262,28 +290,22 @@ func HandleValidateAdminJWT(writer http.ResponseWriter, request *http.Request) e
 		return nil
 	}
 
-	var token *jwt.Token
-	token, err = ValidateJWT(jwtRequest.Token)
+	// only access tokens of active sessions are valid, mfa and password change tokens don't make a logged in admin
+	claims, err := a.authenticateToken(request.Context(), jwtRequest.Token, PurposeAccess)
 
-	if err != nil {
-		err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "Binvalid token"})
-		if err != nil {
-			fmt.Println("Server: Error ocurred: ", err.Error())
-		}
+	if err != nil && writeContextError(writer, err) {
 		return nil
 	}
 
-	if !token.Valid {
-		err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "Cinvalid token"})
+	if err != nil {
+		err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "Binvalid token"})
 		if err != nil {
 			fmt.Println("Server: Error ocurred: ", err.Error())
 		}
 		return nil
 	}
 
-	claims, _ := token.Claims.(jwt.MapClaims)
-
-	if jwtRequest.ID != claims["ID"] {
+	if jwtRequest.ID != claims.Subject || claims.SubjectType != customTypes.ADMIN {
 		err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "Dinvalid token"})
 		if err != nil {
 			fmt.Println("Server: Error ocurred: ", err.Error())
@@ -294,14 +316,14 @@ func HandleValidateAdminJWT(writer http.ResponseWriter, request *http.Request) e
 	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "valid token"})
 }
 
-func HandleGetAdminByID(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleGetAdminByID(writer http.ResponseWriter, request *http.Request) error {
 	reqID := mux.Vars(request)["ID"]
 
 	if reqID == "" {
 		return errors.New("asinvalid ID")
 	}
 
-	adm, err := db.GetAdminByID(reqID)
+	adm, err := a.Admins.GetByID(request.Context(), reqID)
 
 	if err != nil {
 		return err
@@ -310,7 +332,7 @@ func HandleGetAdminByID(writer http.ResponseWriter, request *http.Request) error
 	return WriteJSON(writer, http.StatusOK, adm)
 }
 
-func HandleGetMultibleUsers(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleGetMultibleUsers(writer http.ResponseWriter, request *http.Request) error {
 	quantityParam := request.URL.Query().Get("quantity")
 
 	var quantity int
@@ -326,8 +348,7 @@ func HandleGetMultibleUsers(writer http.ResponseWriter, request *http.Request) e
 		quantity = 10
 	}
 
-	var userList *[]customTypes.User
-	userList, _, err = db.GetMultiblePersons(customTypes.USER, quantity)
+	userList, err := a.Users.List(request.Context(), quantity)
 
 	if err != nil {
 		return err
@@ -336,14 +357,21 @@ func HandleGetMultibleUsers(writer http.ResponseWriter, request *http.Request) e
 	return WriteJSON(writer, http.StatusOK, userList)
 }
 
-func HandleDeleteUser(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleDeleteUser(writer http.ResponseWriter, request *http.Request) error {
 	userID := mux.Vars(request)["ID"]
 
 	if userID == "" {
 		return errors.New("id invalid")
 	}
 
-	err := db.DeletePerson(customTypes.USER, userID)
+	err := a.Users.Delete(request.Context(), userID)
+
+	if err != nil {
+		return err
+	}
+
+	// the tokens of a deleted account must stop working, this revokes the refresh tokens of every session as well
+	err = a.Sessions.RevokeOfPerson(request.Context(), customTypes.USER, userID)
 
 	if err != nil {
 		return err
@@ -352,7 +380,7 @@ func HandleDeleteUser(writer http.ResponseWriter, request *http.Request) error {
 	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "user " + userID + " deleted"})
 }
 
-func HandleSearchUsers(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleSearchUsers(writer http.ResponseWriter, request *http.Request) error {
 
 	var userSearchRequest *customTypes.SearchUserRequest
 
@@ -362,9 +390,7 @@ func HandleSearchUsers(writer http.ResponseWriter, request *http.Request) error
 		return errors.New("unable to parse json " + err.Error())
 	}
 
-	var userList *[]customTypes.User
-
-	userList, _, err = db.SearchPersons(customTypes.USER, userSearchRequest, nil)
+	userList, err := a.Users.Search(request.Context(), userSearchRequest)
 
 	if err != nil {
 		return err
@@ -373,7 +399,7 @@ func HandleSearchUsers(writer http.ResponseWriter, request *http.Request) error
 	return WriteJSON(writer, http.StatusOK, userList)
 }
 
-func HandleGetMultibleAdmins(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleGetMultibleAdmins(writer http.ResponseWriter, request *http.Request) error {
 	quantityParam := request.URL.Query().Get("quantity")
 
 	var quantity int
@@ -388,8 +414,7 @@ func HandleGetMultibleAdmins(writer http.ResponseWriter, request *http.Request)
 	} else {
 		quantity = 10
 	}
-	var adminList *[]customTypes.Admin
-	_, adminList, err = db.GetMultiblePersons(customTypes.ADMIN, quantity)
+	adminList, err := a.Admins.List(request.Context(), quantity)
 
 	if err != nil {
 		return err
@@ -398,7 +423,7 @@ func HandleGetMultibleAdmins(writer http.ResponseWriter, request *http.Request)
 	return WriteJSON(writer, http.StatusOK, adminList)
 }
 
-func HandleEditAdmin(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleEditAdmin(writer http.ResponseWriter, request *http.Request) error {
 
 	adminID := mux.Vars(request)["ID"]
 
@@ -414,25 +439,42 @@ func HandleEditAdmin(writer http.ResponseWriter, request *http.Request) error {
 		return errors.New("unable to parse json" + err.Error())
 	}
 
-	var admID string
+	err = a.Admins.Edit(request.Context(), adminID, &editAdm)
 
-	admID, err = db.EditPerson(customTypes.ADMIN, adminID, nil, &editAdm)
+	if errors.Is(err, store.ErrEmailInUse) {
+		return &ApiError{StatusCode: http.StatusConflict, Err: err}
+	}
 
 	if err != nil {
 		return err
 	}
 
-	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully updated user  " + admID})
+	if editAdm.Roles != nil {
+		err = a.Admins.SetRoles(request.Context(), adminID, editAdm.Roles)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully updated user  " + adminID})
 }
 
-func HandleDeleteAdmin(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleDeleteAdmin(writer http.ResponseWriter, request *http.Request) error {
 	adminID := mux.Vars(request)["ID"]
 
 	if adminID == "" {
 		return errors.New("id invalid")
 	}
 
-	err := db.DeletePerson(customTypes.ADMIN, adminID)
+	err := a.Admins.Delete(request.Context(), adminID)
+
+	if err != nil {
+		return err
+	}
+
+	// the tokens of a deleted account must stop working, this revokes the refresh tokens of every session as well
+	err = a.Sessions.RevokeOfPerson(request.Context(), customTypes.ADMIN, adminID)
 
 	if err != nil {
 		return err
@@ -441,7 +483,7 @@ func HandleDeleteAdmin(writer http.ResponseWriter, request *http.Request) error
 	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "admin " + adminID + " deleted"})
 }
 
-func HandleAddAdmin(writer http.ResponseWriter, request *http.Request) error {
+func (a *API) HandleAddAdmin(writer http.ResponseWriter, request *http.Request) error {
 
 	var addAdm customTypes.AddAdminRequest
 
@@ -451,9 +493,19 @@ func HandleAddAdmin(writer http.ResponseWriter, request *http.Request) error {
 		return errors.New("unable to parse json" + err.Error())
 	}
 
+	err = validatePassword(addAdm.Password, addAdm.Email)
+
+	if err != nil {
+		return err
+	}
+
 	var newAdmin *customTypes.Admin
 
-	newAdmin, err = db.AddAdmin(&addAdm)
+	newAdmin, err = a.Admins.Add(request.Context(), &addAdm)
+
+	if errors.Is(err, store.ErrEmailInUse) {
+		return &ApiError{StatusCode: http.StatusConflict, Err: err}
+	}
 
 	if err != nil {
 		return err
@@ -462,6 +514,51 @@ func HandleAddAdmin(writer http.ResponseWriter, request *http.Request) error {
 	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "admin " + newAdmin.UserName + " successfullyy created"})
 }
 
+func (a *API) HandleGetRoles(writer http.ResponseWriter, request *http.Request) error {
+	roleList, err := a.Roles.List(request.Context())
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, roleList)
+}
+
+func (a *API) HandleSetAdminRoles(writer http.ResponseWriter, request *http.Request) error {
+	adminID := mux.Vars(request)["ID"]
+
+	if adminID == "" {
+		return errors.New("id invalid")
+	}
+
+	var rolesRequest customTypes.SetAdminRolesRequest
+
+	err := ParseJSON(request, &rolesRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json" + err.Error())
+	}
+
+	// make sure the admin exists before roles get assigned to it
+	_, err = a.Admins.GetByID(request.Context(), adminID)
+
+	if err != nil {
+		return err
+	}
+
+	if rolesRequest.Roles == nil {
+		rolesRequest.Roles = []string{}
+	}
+
+	err = a.Admins.SetRoles(request.Context(), adminID, rolesRequest.Roles)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully updated roles of admin " + adminID})
+}
+
 func HandleGetDockerContainers(writer http.ResponseWriter, _ *http.Request) error {
 	cli, err := client.NewClientWithOpts(client.FromEnv)
 
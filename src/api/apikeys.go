@@ -0,0 +1,190 @@
+package api
+
+import (
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// api keys look like "bk_<prefix>_<secret>", the prefix is stored in clear text to find the key
+const apiKeyPrefix = "bk"
+
+// generateApiKey returns a new key and its visible prefix
+func generateApiKey() (string, string, error) {
+	buffer := make([]byte, 4)
+
+	_, err := rand.Read(buffer)
+
+	if err != nil {
+		return "", "", errors.New("unable to generate api key prefix: " + err.Error())
+	}
+
+	prefix := hex.EncodeToString(buffer)
+
+	secret, err := utils.GenerateToken(32)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return apiKeyPrefix + "_" + prefix + "_" + secret, prefix, nil
+}
+
+// apiKeyFromRequest returns the key of an "Authorization: Bearer bk_..." header
+func apiKeyFromRequest(request *http.Request) string {
+	scheme, key, found := strings.Cut(request.Header.Get("Authorization"), " ")
+
+	if !found || !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(key, apiKeyPrefix+"_") {
+		return ""
+	}
+
+	return strings.TrimSpace(key)
+}
+
+/*
+authenticateApiKey checks the key and returns the service principal of it.
+The key only keeps the scopes its creator still has, so removing a role from an admin
+or deleting the admin takes the permissions from the keys as well
+*/
+func (a *API) authenticateApiKey(ctx context.Context, key string) (*Principal, error) {
+	parts := strings.SplitN(key, "_", 3)
+
+	if len(parts) != 3 {
+		return nil, errors.New("invalid api key")
+	}
+
+	stored, err := a.ApiKeys.GetByPrefix(ctx, parts[1])
+
+	if err != nil {
+		return nil, errors.New("invalid api key")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stored.KeyHash), []byte(utils.HashToken(key))) != 1 || stored.Revoked {
+		return nil, errors.New("invalid api key")
+	}
+
+	creator := &Principal{ID: stored.CreatedBy, Type: customTypes.ADMIN}
+
+	creator.Roles, err = a.Admins.GetRoles(ctx, stored.CreatedBy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []string{}
+	for _, scope := range stored.Scopes {
+		if a.hasPermission(ctx, creator, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	err = a.ApiKeys.Touch(ctx, stored.ID, time.Now())
+
+	if err != nil {
+		fmt.Println("Server: Error ocurred: ", err.Error())
+	}
+
+	return &Principal{
+		ID:     stored.ID,
+		Type:   customTypes.SERVICE,
+		Roles:  []string{},
+		Scopes: scopes,
+	}, nil
+}
+
+// HandleCreateApiKey creates a key with a subset of the admin's permissions, the key is only returned once
+func (a *API) HandleCreateApiKey(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	var keyRequest customTypes.CreateApiKeyRequest
+
+	err := ParseJSON(request, &keyRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	if strings.TrimSpace(keyRequest.Name) == "" {
+		return errors.New("name missing")
+	}
+
+	if len(keyRequest.Scopes) == 0 {
+		return errors.New("scopes missing")
+	}
+
+	slices.Sort(keyRequest.Scopes)
+	keyRequest.Scopes = slices.Compact(keyRequest.Scopes)
+
+	// admins can't hand out permissions they don't have themselves
+	for _, scope := range keyRequest.Scopes {
+		if !a.hasPermission(request.Context(), principal, scope) {
+			return NewApiError(http.StatusForbidden, "scope "+scope+" not granted to you")
+		}
+	}
+
+	key, prefix, err := generateApiKey()
+
+	if err != nil {
+		return err
+	}
+
+	apiKey := &customTypes.ApiKey{
+		ID:        uuid.NewString(),
+		Name:      strings.TrimSpace(keyRequest.Name),
+		Prefix:    prefix,
+		KeyHash:   utils.HashToken(key),
+		Scopes:    keyRequest.Scopes,
+		CreatedBy: principal.ID,
+		Created:   time.Now().Unix(),
+	}
+
+	err = a.ApiKeys.Create(request.Context(), apiKey)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusCreated, map[string]any{"apiKey": key, "key": apiKey})
+}
+
+func (a *API) HandleGetApiKeys(writer http.ResponseWriter, request *http.Request) error {
+	keys, err := a.ApiKeys.List(request.Context())
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, keys)
+}
+
+func (a *API) HandleRevokeApiKey(writer http.ResponseWriter, request *http.Request) error {
+	keyID := mux.Vars(request)["id"]
+
+	if keyID == "" {
+		return errors.New("id invalid")
+	}
+
+	found, err := a.ApiKeys.Revoke(request.Context(), keyID)
+
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return NewApiError(http.StatusNotFound, "api key not found")
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully revoked api key " + keyID})
+}
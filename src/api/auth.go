@@ -0,0 +1,175 @@
+package api
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Principal is the authenticated user or admin of a request, JWTAuth puts it on the request context
+type Principal struct {
+	ID      string
+	Type    customTypes.Person
+	Roles   []string
+	TokenID string
+	Purpose string
+	// SessionID is set for access tokens, it is the jti of the token
+	SessionID string
+	// Scopes are the permissions of api keys, service principals have no roles
+	Scopes []string
+	// Actor is set while an admin impersonates the principal
+	Actor *Actor
+}
+
+type contextKey string
+
+const principalContextKey contextKey = "principal"
+
+// PrincipalFromContext returns the principal JWTAuth stored for the current request
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey).(*Principal)
+	return principal, ok
+}
+
+// HasRole checks if one of the given roles was granted to the principal
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, granted := range p.Roles {
+		for _, role := range roles {
+			if granted == role {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hasPermission checks if one of the principal's roles, or the scopes of an api key, grant at least one of the permissions
+func (a *API) hasPermission(ctx context.Context, p *Principal, permissions ...string) bool {
+	granted := p.Scopes
+
+	if p.Type != customTypes.SERVICE {
+		var err error
+		granted, err = a.Roles.GetPermissions(ctx, p.Roles)
+
+		if err != nil {
+			fmt.Println("Server: Error ocurred: ", err.Error())
+			return false
+		}
+	}
+
+	for _, permission := range granted {
+		for _, required := range permissions {
+			if permission == required {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func writeForbidden(writer http.ResponseWriter) {
+	err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "permission denied"})
+	if err != nil {
+		fmt.Println("Server: Error ocurred: ", err.Error())
+	}
+}
+
+// RequireRole only lets principals with one of the roles pass, it has to be wrapped by JWTAuth
+func RequireRole(roles ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handlerFunc http.HandlerFunc) http.HandlerFunc {
+		return func(writer http.ResponseWriter, request *http.Request) {
+			principal, ok := PrincipalFromContext(request.Context())
+
+			if !ok || !principal.HasRole(roles...) {
+				writeForbidden(writer)
+				return
+			}
+
+			handlerFunc(writer, request)
+		}
+	}
+}
+
+/*
+RequirePermission only lets principals pass whose roles grant at least one of the permissions.
+The permissions of a role are looked up on every request, so changing them applies immediately.
+The roles themselves come from the access token, assigning or removing a role applies on the next refresh
+*/
+func (a *API) RequirePermission(permissions ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handlerFunc http.HandlerFunc) http.HandlerFunc {
+		return func(writer http.ResponseWriter, request *http.Request) {
+			principal, ok := PrincipalFromContext(request.Context())
+
+			if !ok || !a.hasPermission(request.Context(), principal, permissions...) {
+				writeForbidden(writer)
+				return
+			}
+
+			handlerFunc(writer, request)
+		}
+	}
+}
+
+/*
+RequireSelfOrPermission guards routes acting on the {ID} in the path.
+Principals of the given type may act on their own record, everyone else needs the permission
+*/
+func (a *API) RequireSelfOrPermission(person customTypes.Person, permission string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handlerFunc http.HandlerFunc) http.HandlerFunc {
+		return func(writer http.ResponseWriter, request *http.Request) {
+			principal, ok := PrincipalFromContext(request.Context())
+
+			if !ok {
+				writeForbidden(writer)
+				return
+			}
+
+			isSelf := principal.Type == person && principal.ID == mux.Vars(request)["ID"]
+
+			if !isSelf && !a.hasPermission(request.Context(), principal, permission) {
+				writeForbidden(writer)
+				return
+			}
+
+			handlerFunc(writer, request)
+		}
+	}
+}
+
+// RequireSelf only lets the principal act on its own record, e.g. to change its password
+func RequireSelf(person customTypes.Person) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handlerFunc http.HandlerFunc) http.HandlerFunc {
+		return func(writer http.ResponseWriter, request *http.Request) {
+			principal, ok := PrincipalFromContext(request.Context())
+
+			if !ok || principal.Type != person || principal.ID != mux.Vars(request)["ID"] {
+				writeForbidden(writer)
+				return
+			}
+
+			handlerFunc(writer, request)
+		}
+	}
+}
+
+// DenyImpersonation blocks actions an admin must not take in the name of a user, e.g. deleting the account
+func DenyImpersonation(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		principal, ok := PrincipalFromContext(request.Context())
+
+		if ok && principal.Actor != nil {
+			err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "not allowed while impersonating"})
+			if err != nil {
+				fmt.Println("Server: Error ocurred: ", err.Error())
+			}
+			return
+		}
+
+		handlerFunc(writer, request)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// names of the auth cookies and headers of the cookie mode
+const (
+	accessCookieName  = "access_token"
+	refreshCookieName = "refresh_token"
+	csrfCookieName    = "csrf_token"
+	csrfHeaderName    = "X-CSRF-Token"
+	// clients opt into the cookie mode at login with "X-Auth-Mode: cookie"
+	authModeHeaderName = "X-Auth-Mode"
+)
+
+// cookieAuthEnabled reports if COOKIE_AUTH allows the cookie mode, API clients keep using the xJwtToken header
+func cookieAuthEnabled() bool {
+	return utils.GetEnvBool("COOKIE_AUTH", false)
+}
+
+// wantsCookies checks if the tokens of a login or refresh go into cookies instead of the body
+func wantsCookies(request *http.Request) bool {
+	return cookieAuthEnabled() && strings.EqualFold(request.Header.Get(authModeHeaderName), "cookie")
+}
+
+// cookieSecure is true unless COOKIE_SECURE is explicitly false, only local development over plain http should disable it
+func cookieSecure() bool {
+	return utils.GetEnvBool("COOKIE_SECURE", true)
+}
+
+func cookieSameSite() http.SameSite {
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+func newAuthCookie(name, value string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: httpOnly,
+		Secure:   cookieSecure(),
+		SameSite: cookieSameSite(),
+	}
+}
+
+/*
+setAuthCookies stores the tokens in HttpOnly cookies and sets a new csrf token.
+The access cookie lives as long as the refresh token, so an expired access token is still sent
+and the client gets the "token expired" response telling it to refresh
+*/
+func setAuthCookies(writer http.ResponseWriter, tokens *customTypes.TokenPair) error {
+	csrfToken, err := utils.GenerateToken(32)
+
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(writer, newAuthCookie(accessCookieName, tokens.AccessToken, refreshTokenTTL(), true))
+	http.SetCookie(writer, newAuthCookie(refreshCookieName, tokens.RefreshToken, refreshTokenTTL(), true))
+	// the csrf cookie has to be readable by the dashboard, it sends the value back in the X-CSRF-Token header
+	http.SetCookie(writer, newAuthCookie(csrfCookieName, csrfToken, refreshTokenTTL(), false))
+
+	return nil
+}
+
+func clearAuthCookies(writer http.ResponseWriter) {
+	for _, name := range []string{accessCookieName, refreshCookieName} {
+		http.SetCookie(writer, newAuthCookie(name, "", -time.Second, true))
+	}
+
+	http.SetCookie(writer, newAuthCookie(csrfCookieName, "", -time.Second, false))
+}
+
+/*
+writeTokens answers a login with the token pair: in cookie mode the tokens are set as cookies
+and left out of the body, otherwise the access token is returned under tokenKey
+*/
+func writeTokens(writer http.ResponseWriter, request *http.Request, tokens *customTypes.TokenPair, tokenKey string, response map[string]any) error {
+	response["expiresAt"] = tokens.ExpiresAt
+
+	if wantsCookies(request) {
+		err := setAuthCookies(writer, tokens)
+
+		if err != nil {
+			return err
+		}
+
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	response[tokenKey] = tokens.AccessToken
+	response["refreshToken"] = tokens.RefreshToken
+
+	return WriteJSON(writer, http.StatusOK, response)
+}
+
+// accessTokenFromRequest prefers the xJwtToken header, the cookie is only used without it
+func accessTokenFromRequest(request *http.Request) (string, bool) {
+	tokenString := request.Header.Get("xJwtToken")
+
+	if tokenString != "" || !cookieAuthEnabled() {
+		return tokenString, false
+	}
+
+	cookie, err := request.Cookie(accessCookieName)
+
+	if err != nil {
+		return "", false
+	}
+
+	return cookie.Value, true
+}
+
+// refreshTokenFromCookie returns the refresh token of the cookie mode
+func refreshTokenFromCookie(request *http.Request) string {
+	if !cookieAuthEnabled() {
+		return ""
+	}
+
+	cookie, err := request.Cookie(refreshCookieName)
+
+	if err != nil {
+		return ""
+	}
+
+	return cookie.Value
+}
+
+/*
+validCSRF implements the double-submit check for requests authenticated by cookie:
+state-changing requests have to repeat the value of the csrf cookie in the X-CSRF-Token header,
+which other sites can't do because they can't read the cookie
+*/
+func validCSRF(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := request.Cookie(csrfCookieName)
+
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := request.Header.Get(csrfHeaderName)
+
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
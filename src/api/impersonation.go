@@ -0,0 +1,104 @@
+package api
+
+import (
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const defaultImpersonationTTL = 15 * time.Minute
+
+// auditImpersonation records a request made with an impersonation token, failures are only logged
+func (a *API) auditImpersonation(request *http.Request, principal *Principal, status int) {
+	// the request is answered already, the entry is written even if the client left meanwhile
+	err := a.Audit.Add(context.WithoutCancel(request.Context()), &customTypes.AuditEntry{
+		ActorID:     principal.Actor.Subject,
+		ActorType:   principal.Actor.SubjectType,
+		SubjectID:   principal.ID,
+		SubjectType: principal.Type,
+		Action:      request.Method + " " + request.URL.Path,
+		Status:      status,
+		IP:          ClientIP(request),
+		Created:     time.Now().Unix(),
+	})
+
+	if err != nil {
+		fmt.Println("Server: Error writing audit log: ", err.Error())
+	}
+}
+
+/*
+HandleImpersonateUser issues a short-lived user token for the admin. The act claim names the admin,
+there is no refresh token and requests made with the token are written to the audit log
+*/
+func (a *API) HandleImpersonateUser(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	userID := mux.Vars(request)["userID"]
+
+	if userID == "" {
+		return errors.New("id invalid")
+	}
+
+	_, err := a.Users.GetByID(request.Context(), userID)
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusNotFound, Err: err}
+	}
+
+	claims := newAccessClaims(userID, customTypes.USER, []string{baseRole(customTypes.USER)})
+	claims.Actor = &Actor{Subject: principal.ID, SubjectType: principal.Type}
+	claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(utils.GetEnvDuration("IMPERSONATION_TTL", defaultImpersonationTTL)))
+
+	token, err := CreateJWT(claims)
+
+	if err != nil {
+		return errors.New("error while creating jwt token: " + err.Error())
+	}
+
+	err = a.Audit.Add(request.Context(), &customTypes.AuditEntry{
+		ActorID:     principal.ID,
+		ActorType:   principal.Type,
+		SubjectID:   userID,
+		SubjectType: customTypes.USER,
+		Action:      "impersonation started",
+		Status:      http.StatusOK,
+		IP:          ClientIP(request),
+		Created:     time.Now().Unix(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]any{"message": "Sucessfully impersonating user " + userID, "X-JWT-Token": token, "expiresAt": claims.ExpiresAt.Unix(), "impersonating": true, "actor": principal.ID})
+}
+
+func (a *API) HandleGetAuditLog(writer http.ResponseWriter, request *http.Request) error {
+	quantity := 100
+
+	if value := request.URL.Query().Get("quantity"); value != "" {
+		var err error
+		quantity, err = strconv.Atoi(value)
+
+		if err != nil || quantity < 1 {
+			return errors.New("quantity invalid")
+		}
+	}
+
+	entries, err := a.Audit.List(request.Context(), quantity)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, entries)
+}
@@ -0,0 +1,461 @@
+package api
+
+import (
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// TokenClaims are the claims of every access token, the subject is the ID of the user or admin
+type TokenClaims struct {
+	SubjectType customTypes.Person `json:"subType"`
+	Roles       []string           `json:"roles"`
+	// Purpose restricts a token to a single step, e.g. finishing the mfa login, access tokens have none
+	Purpose string `json:"purpose,omitempty"`
+	// Actor is the admin behind an impersonation token (RFC 8693 act claim)
+	Actor *Actor `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type Actor struct {
+	Subject     string             `json:"sub"`
+	SubjectType customTypes.Person `json:"subType"`
+}
+
+// purposes of restricted tokens
+const (
+	PurposeAccess         = ""
+	PurposeMFA            = "mfa"
+	PurposePasswordChange = "password_change"
+)
+
+// baseRole is the role every principal of the type has, it grants no permissions
+func baseRole(person customTypes.Person) string {
+	if person == customTypes.ADMIN {
+		return customTypes.RoleAdmin
+	}
+
+	return customTypes.RoleUser
+}
+
+// rolesFor returns the roles of a person, admins get the roles assigned to them
+func (a *API) rolesFor(ctx context.Context, personID string, person customTypes.Person) ([]string, error) {
+	if person != customTypes.ADMIN {
+		return []string{baseRole(person)}, nil
+	}
+
+	assigned, err := a.Admins.GetRoles(ctx, personID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{baseRole(person)}, assigned...), nil
+}
+
+func accessTokenTTL() time.Duration {
+	return utils.GetEnvDuration("JWT_ACCESS_TTL", defaultAccessTokenTTL)
+}
+
+func refreshTokenTTL() time.Duration {
+	return utils.GetEnvDuration("JWT_REFRESH_TTL", defaultRefreshTokenTTL)
+}
+
+// middleware, only accepts regular access tokens and api keys
+func (a *API) JWTAuth(handlerFunc http.HandlerFunc) http.HandlerFunc {
+	return a.TokenAuth(PurposeAccess)(handlerFunc)
+}
+
+// TokenAuth authenticates the request with a token of one of the purposes and stores the principal on the context
+func (a *API) TokenAuth(purposes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handlerFunc http.HandlerFunc) http.HandlerFunc {
+		return func(writer http.ResponseWriter, request *http.Request) {
+
+			// api keys replace regular access tokens, they can't be used for a restricted purpose
+			if apiKey := apiKeyFromRequest(request); apiKey != "" {
+				if !slices.Contains(purposes, PurposeAccess) {
+					writeForbidden(writer)
+					return
+				}
+
+				principal, err := a.authenticateApiKey(request.Context(), apiKey)
+
+				if err != nil {
+					err := WriteJSON(writer, http.StatusUnauthorized, map[string]string{"message": err.Error()})
+					if err != nil {
+						fmt.Println("Server: Error ocurred: ", err.Error())
+					}
+					return
+				}
+
+				handlerFunc(writer, request.WithContext(context.WithValue(request.Context(), principalContextKey, principal)))
+				return
+			}
+
+			tokenString, fromCookie := accessTokenFromRequest(request)
+
+			// cookies are sent by the browser on its own, so requests relying on them need the csrf token
+			if fromCookie && !validCSRF(request) {
+				err := WriteJSON(writer, http.StatusForbidden, map[string]string{"message": "invalid csrf token"})
+				if err != nil {
+					fmt.Println("Server: Error ocurred: ", err.Error())
+				}
+				return
+			}
+
+			claims, err := a.authenticateToken(request.Context(), tokenString, purposes...)
+
+			if err != nil {
+				var apiErr *ApiError
+
+				if !writeContextError(writer, err) && errors.As(err, &apiErr) {
+					WriteError(writer, apiErr.StatusCode, apiErr)
+				}
+				return
+			}
+
+			principal := &Principal{
+				ID:      claims.Subject,
+				Type:    claims.SubjectType,
+				Roles:   claims.Roles,
+				TokenID: claims.ID,
+				Purpose: claims.Purpose,
+			}
+
+			if claims.Purpose == PurposeAccess && claims.Actor == nil {
+				principal.SessionID = claims.ID
+			}
+
+			request = request.WithContext(context.WithValue(request.Context(), principalContextKey, principal))
+
+			// every request of an impersonation is recorded with both identities
+			if claims.Actor != nil {
+				principal.Actor = claims.Actor
+
+				recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+				handlerFunc(recorder, request)
+				a.auditImpersonation(request, principal, recorder.status)
+				return
+			}
+
+			handlerFunc(writer, request)
+		}
+	}
+}
+
+/*
+authenticateToken checks the signature of the token, that it was issued for one of the purposes and that neither
+the token nor its session were revoked. The ApiError carries the status to answer with, 401 tells clients to refresh
+*/
+func (a *API) authenticateToken(ctx context.Context, tokenString string, purposes ...string) (*TokenClaims, error) {
+	claims, err := ValidateJWT(tokenString)
+
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, NewApiError(http.StatusUnauthorized, "token expired")
+	}
+
+	if err != nil || !slices.Contains(purposes, claims.Purpose) {
+		return nil, NewApiError(http.StatusForbidden, "permission denied")
+	}
+
+	revoked, err := a.Revocations.IsRevoked(ctx, claims.ID)
+
+	// access tokens are bound to the session they were issued for, the jti is the SessionID
+	if err == nil && !revoked && claims.Purpose == PurposeAccess && claims.Actor == nil {
+		revoked = !a.sessionActive(ctx, claims.ID, claims.Subject, claims.SubjectType)
+	}
+
+	if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return nil, err
+	}
+
+	if err != nil || revoked {
+		return nil, NewApiError(http.StatusUnauthorized, "token revoked")
+	}
+
+	return claims, nil
+}
+
+// ValidateJWT checks signature, exp, nbf and iat of the token and returns its claims
+func ValidateJWT(tokenString string) (*TokenClaims, error) {
+
+	var claims TokenClaims
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, keyManager.Keyfunc, jwt.WithValidMethods(keyManager.Methods()), jwt.WithExpirationRequired(), jwt.WithIssuedAt())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	if claims.ID == "" {
+		return nil, errors.New("token has no id")
+	}
+
+	return &claims, nil
+}
+
+// CreateJWT signs the claims with the active key of the key manager
+func CreateJWT(claims *TokenClaims) (string, error) {
+	return keyManager.Sign(claims)
+}
+
+// newAccessClaims creates the claims for a short lived access token
+func newAccessClaims(personID string, person customTypes.Person, roles []string) *TokenClaims {
+	now := time.Now()
+
+	return &TokenClaims{
+		SubjectType: person,
+		Roles:       roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   personID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL())),
+		},
+	}
+}
+
+// IssuePurposeToken creates a short lived token which can only be used for the given purpose, it carries no permissions
+func IssuePurposeToken(personID string, person customTypes.Person, purpose string, ttl time.Duration) (string, error) {
+	claims := newAccessClaims(personID, person, []string{baseRole(person)})
+	claims.Purpose = purpose
+	claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(ttl))
+
+	return CreateJWT(claims)
+}
+
+/*
+IssueTokens creates an access token and a refresh token for the session, the refresh token is only stored as hash.
+The session is the family of the refresh token and the jti of the access token, so revoking the session ends both
+*/
+func (a *API) IssueTokens(ctx context.Context, personID string, person customTypes.Person, sessionID string) (*customTypes.TokenPair, error) {
+	err := a.ensurePersonExists(ctx, personID, person)
+
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := a.rolesFor(ctx, personID, person)
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims := newAccessClaims(personID, person, roles)
+	claims.ID = sessionID
+
+	accessToken, err := CreateJWT(claims)
+
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateToken(32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(refreshTokenTTL()).Unix()
+
+	err = a.Sessions.SaveRefreshToken(ctx, &customTypes.RefreshToken{
+		TokenHash:  utils.HashToken(refreshToken),
+		FamilyID:   sessionID,
+		PersonID:   personID,
+		PersonType: person,
+		ExpiresAt:  expiresAt,
+		Created:    now.Unix(),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the session lives as long as its newest refresh token
+	err = a.Sessions.Extend(ctx, sessionID, now, expiresAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &customTypes.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    claims.ExpiresAt.Unix(),
+	}, nil
+}
+
+func (a *API) HandleRefreshToken(writer http.ResponseWriter, request *http.Request) error {
+	var refreshRequest customTypes.RefreshTokenRequest
+
+	// in cookie mode the refresh token is taken from the cookie and the body is optional
+	if request.ContentLength != 0 {
+		err := ParseJSON(request, &refreshRequest)
+
+		if err != nil {
+			return errors.New("unable to parse json " + err.Error())
+		}
+	}
+
+	fromCookie := false
+
+	if refreshRequest.RefreshToken == "" {
+		refreshRequest.RefreshToken = refreshTokenFromCookie(request)
+		fromCookie = refreshRequest.RefreshToken != ""
+	}
+
+	if fromCookie && !validCSRF(request) {
+		return NewApiError(http.StatusForbidden, "invalid csrf token")
+	}
+
+	if refreshRequest.RefreshToken == "" {
+		return NewApiError(http.StatusUnauthorized, "invalid refresh token")
+	}
+
+	stored, err := a.Sessions.GetRefreshToken(request.Context(), utils.HashToken(refreshRequest.RefreshToken))
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	if stored.ExpiresAt < time.Now().Unix() {
+		return NewApiError(http.StatusUnauthorized, "refresh token expired")
+	}
+
+	consumed, err := a.Sessions.ConsumeRefreshToken(request.Context(), stored.TokenHash)
+
+	if err != nil {
+		return err
+	}
+
+	if !consumed {
+		// a refresh token was used twice, so it probably leaked: end the whole session
+		err = a.Sessions.Revoke(request.Context(), stored.FamilyID)
+
+		if err != nil {
+			return err
+		}
+
+		return NewApiError(http.StatusUnauthorized, "refresh token already used")
+	}
+
+	if !a.sessionActive(request.Context(), stored.FamilyID, stored.PersonID, stored.PersonType) {
+		return NewApiError(http.StatusUnauthorized, "session revoked")
+	}
+
+	tokens, err := a.IssueTokens(request.Context(), stored.PersonID, stored.PersonType, stored.FamilyID)
+
+	if err != nil {
+		return fmt.Errorf("error while creating jwt token: %w", err)
+	}
+
+	if fromCookie {
+		err = setAuthCookies(writer, tokens)
+
+		if err != nil {
+			return err
+		}
+
+		return WriteJSON(writer, http.StatusOK, map[string]int64{"expiresAt": tokens.ExpiresAt})
+	}
+
+	return WriteJSON(writer, http.StatusOK, tokens)
+}
+
+func (a *API) HandleLogout(writer http.ResponseWriter, request *http.Request) error {
+	var logoutRequest customTypes.LogoutRequest
+
+	// the body is optional, the access token alone can be revoked as well
+	if request.ContentLength != 0 {
+		err := ParseJSON(request, &logoutRequest)
+
+		if err != nil {
+			return errors.New("unable to parse json " + err.Error())
+		}
+	}
+
+	tokenString, fromCookie := accessTokenFromRequest(request)
+
+	if logoutRequest.RefreshToken == "" {
+		logoutRequest.RefreshToken = refreshTokenFromCookie(request)
+		fromCookie = fromCookie || logoutRequest.RefreshToken != ""
+	}
+
+	if tokenString == "" && logoutRequest.RefreshToken == "" {
+		return errors.New("no token to revoke")
+	}
+
+	if fromCookie {
+		if !validCSRF(request) {
+			return NewApiError(http.StatusForbidden, "invalid csrf token")
+		}
+
+		clearAuthCookies(writer)
+	}
+
+	if logoutRequest.RefreshToken != "" {
+		stored, err := a.Sessions.GetRefreshToken(request.Context(), utils.HashToken(logoutRequest.RefreshToken))
+
+		if err != nil {
+			return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+		}
+
+		err = a.Sessions.Revoke(request.Context(), stored.FamilyID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if tokenString != "" {
+		claims, err := ValidateJWT(tokenString)
+
+		// expired or invalid tokens are useless anyway
+		if err == nil && claims.Purpose == PurposeAccess && claims.Actor == nil {
+			err = a.Sessions.Revoke(request.Context(), claims.ID)
+
+			if err != nil {
+				return err
+			}
+		} else if err == nil {
+			err = a.Revocations.Revoke(request.Context(), claims.ID, claims.ExpiresAt.Unix())
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := a.Sessions.DeleteExpired(request.Context())
+
+	if err != nil {
+		fmt.Println("Server: Error ocurred: ", err.Error())
+	}
+
+	err = a.Revocations.DeleteExpired(request.Context())
+
+	if err != nil {
+		fmt.Println("Server: Error ocurred: ", err.Error())
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully logged out"})
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// kid of the key created from JWT_SECRET, tokens without kid header are verified with it as well
+const secretKeyID = "secret"
+
+// developmentSecrets were published with the repository, anyone could sign tokens with them
+var developmentSecrets = []string{"local-development-secret", "secret", "changeme"}
+
+// SigningKey is a key which can sign and verify tokens, symmetric keys are never published
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+/*
+KeyManager holds every key tokens can be verified with and the active key new tokens get signed with.
+Keys are selected by the kid header, so a new key can become active while tokens signed
+with the old key stay valid until the old key is removed
+*/
+type KeyManager struct {
+	mu       sync.RWMutex
+	keys     map[string]*SigningKey
+	activeID string
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var keyManager = NewKeyManager()
+
+func NewKeyManager() *KeyManager {
+	return &KeyManager{keys: make(map[string]*SigningKey)}
+}
+
+/*
+LoadKeys (re)loads the signing keys from the environment:
+every PEM file in JWT_KEYS_DIR is a private key named after its kid (e.g. 2024-09.pem),
+JWT_SECRET adds a HS256 key, JWT_ACTIVE_KID selects the key used for signing.
+A known development secret is refused, with asymmetric keys it is ignored instead
+*/
+func LoadKeys() error {
+	manager := NewKeyManager()
+
+	keysDir := os.Getenv("JWT_KEYS_DIR")
+
+	if keysDir != "" {
+		files, err := filepath.Glob(filepath.Join(keysDir, "*.pem"))
+
+		if err != nil {
+			return errors.New("unable to list keys: " + err.Error())
+		}
+
+		for _, file := range files {
+			key, err := readSigningKey(file)
+
+			if err != nil {
+				return err
+			}
+
+			manager.AddKey(key)
+		}
+	}
+
+	secret := os.Getenv("JWT_SECRET")
+
+	if slices.Contains(developmentSecrets, secret) {
+		if len(manager.keys) == 0 {
+			return errors.New("JWT_SECRET is a published development value, set a random secret or JWT_KEYS_DIR")
+		}
+
+		fmt.Println("Server: Ignoring the development value of JWT_SECRET, tokens are signed with the keys of JWT_KEYS_DIR")
+		secret = ""
+	}
+
+	if secret != "" {
+		manager.AddKey(&SigningKey{
+			ID:         secretKeyID,
+			Method:     jwt.SigningMethodHS256,
+			PrivateKey: []byte(secret),
+			PublicKey:  []byte(secret),
+		})
+	}
+
+	err := manager.SetActive(os.Getenv("JWT_ACTIVE_KID"))
+
+	if err != nil {
+		return err
+	}
+
+	keyManager.mu.Lock()
+	defer keyManager.mu.Unlock()
+
+	keyManager.keys = manager.keys
+	keyManager.activeID = manager.activeID
+
+	fmt.Println("Server: Loaded", len(manager.keys), "signing keys, active key:", manager.activeID)
+
+	return nil
+}
+
+// readSigningKey parses a PKCS#8 or PKCS#1 private key, the file name without extension becomes the kid
+func readSigningKey(file string) (*SigningKey, error) {
+	content, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, errors.New("unable to read key " + file + ": " + err.Error())
+	}
+
+	block, _ := pem.Decode(content)
+
+	if block == nil {
+		return nil, errors.New("no PEM data in key " + file)
+	}
+
+	var privateKey any
+
+	privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, errors.New("unable to parse key " + file + ": " + err.Error())
+	}
+
+	key := &SigningKey{
+		ID:         strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+		PrivateKey: privateKey,
+	}
+
+	switch typedKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.Method = jwt.SigningMethodRS256
+		key.PublicKey = &typedKey.PublicKey
+	case *ecdsa.PrivateKey:
+		if typedKey.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 ecdsa keys are supported: " + file)
+		}
+		key.Method = jwt.SigningMethodES256
+		key.PublicKey = &typedKey.PublicKey
+	case ed25519.PrivateKey:
+		key.Method = jwt.SigningMethodEdDSA
+		key.PublicKey = typedKey.Public()
+	default:
+		return nil, errors.New("unsupported key type in " + file)
+	}
+
+	return key, nil
+}
+
+func (m *KeyManager) AddKey(key *SigningKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[key.ID] = key
+}
+
+// SetActive selects the signing key, without kid the newest (alphabetically last) asymmetric key is used
+func (m *KeyManager) SetActive(kid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.keys) == 0 {
+		return errors.New("no signing keys configured, set JWT_SECRET or JWT_KEYS_DIR")
+	}
+
+	if kid != "" {
+		if _, exists := m.keys[kid]; !exists {
+			return errors.New("active key " + kid + " doesn't exist")
+		}
+
+		m.activeID = kid
+		return nil
+	}
+
+	ids := make([]string, 0, len(m.keys))
+	for id := range m.keys {
+		if id != secretKeyID {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		m.activeID = secretKeyID
+		return nil
+	}
+
+	sort.Strings(ids)
+	m.activeID = ids[len(ids)-1]
+
+	return nil
+}
+
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key, exists := m.keys[m.activeID]
+	m.mu.RUnlock()
+
+	if !exists {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.PrivateKey)
+}
+
+// Keyfunc returns the verification key for the kid of the token, the algorithm has to match the key
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	// tokens issued before kids were introduced are HMAC signed
+	if kid == "" {
+		kid = secretKeyID
+	}
+
+	m.mu.RLock()
+	key, exists := m.keys[kid]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown key: %v", kid)
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.PublicKey, nil
+}
+
+// Methods returns every algorithm a key exists for
+func (m *KeyManager) Methods() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	methods := []string{}
+	for _, key := range m.keys {
+		methods = append(methods, key.Method.Alg())
+	}
+
+	return methods
+}
+
+// JWKS returns the public keys, so other services can verify tokens without sharing a secret
+func (m *KeyManager) JWKS() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+
+	for _, key := range m.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+
+		switch publicKey := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case *ecdsa.PublicKey:
+			jwk.KeyType = "EC"
+			jwk.Curve = "P-256"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey.X.FillBytes(make([]byte, 32)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(publicKey.Y.FillBytes(make([]byte, 32)))
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			// symmetric keys must stay secret
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+
+	return set
+}
+
+func HandleGetJWKS(writer http.ResponseWriter, _ *http.Request) error {
+	writer.Header().Set("Cache-Control", "public, max-age=300")
+	return WriteJSON(writer, http.StatusOK, keyManager.JWKS())
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	customTypes "backend/src/types"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleGetLockouts lists every account and ip with failed logins, blocked or not
+func (a *API) HandleGetLockouts(writer http.ResponseWriter, request *http.Request) error {
+	attempts, err := a.Attempts.List(request.Context())
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	lockouts := make([]customTypes.Lockout, 0, len(attempts))
+
+	for key, info := range attempts {
+		lockouts = append(lockouts, customTypes.Lockout{
+			Key:              key,
+			Blocked:          info.BlockedUntil.After(now),
+			LoginAttemptInfo: *info,
+		})
+	}
+
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].Key < lockouts[j].Key })
+
+	return WriteJSON(writer, http.StatusOK, lockouts)
+}
+
+// HandleDeleteLockout forgets the failed logins of an account or ip, which ends its block
+func (a *API) HandleDeleteLockout(writer http.ResponseWriter, request *http.Request) error {
+	key := mux.Vars(request)["key"]
+
+	if key == "" {
+		return errors.New("key invalid")
+	}
+
+	info, err := a.Attempts.Get(request.Context(), key)
+
+	if err != nil {
+		return err
+	}
+
+	if info == nil {
+		return NewApiError(http.StatusNotFound, "lockout not found")
+	}
+
+	err = a.Attempts.Delete(request.Context(), key)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "lockout " + key + " cleared"})
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"backend/src/mail"
+	"backend/src/store"
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// PurposeMagicLink marks the signed token in a login link, it is only accepted by /login/magic/verify
+	PurposeMagicLink    = "magic_link"
+	defaultMagicLinkTTL = 15 * time.Minute
+)
+
+// magicLinkThrottleKey is the account the limiter counts link requests for, apart from the password login of the email
+func magicLinkThrottleKey(email string) string {
+	return "magic:" + email
+}
+
+/*
+HandleRequestMagicLink mails a single use login link to the user.
+The response is the same whether the account exists or not, so emails can't be probed
+*/
+func (a *API) HandleRequestMagicLink(writer http.ResponseWriter, request *http.Request) error {
+	var linkRequest customTypes.MagicLinkRequest
+
+	err := ParseJSON(request, &linkRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	// the link keeps the email, it is compared with the stored email of the account when it is opened
+	linkRequest.Email = store.NormalizeEmail(linkRequest.Email)
+
+	response := map[string]string{"message": "if the account exists, a login link was sent"}
+
+	/*
+		every request is counted, so links can't be used to flood an inbox. They are counted under their own key,
+		anybody can request links for any email and must not lock the account out of the password login with it
+	*/
+	ip := ClientIP(request)
+	throttleKey := magicLinkThrottleKey(linkRequest.Email)
+
+	err = a.checkLoginAllowed(request.Context(), throttleKey, ip)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = a.limiter.Fail(request.Context(), throttleKey, ip)
+
+	if err != nil {
+		fmt.Println("Server: Error tracking login attempt: ", err.Error())
+	}
+
+	usrID, err := a.Users.GetIDByEmail(request.Context(), linkRequest.Email)
+
+	if err != nil {
+		fmt.Println("Server: Login link for unknown account requested")
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	// failures past this point are only logged, an error response would reveal that the account exists
+	methods, err := a.Users.GetLoginMethods(request.Context(), usrID)
+
+	if err != nil {
+		fmt.Println("Server: Error getting login methods: ", err.Error())
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	if methods == customTypes.LoginMethodPassword {
+		fmt.Println("Server: Login link for account without magic link login requested")
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	ttl := utils.GetEnvDuration("MAGIC_LINK_TTL", defaultMagicLinkTTL)
+
+	claims := newAccessClaims(usrID, customTypes.USER, []string{baseRole(customTypes.USER)})
+	claims.Purpose = PurposeMagicLink
+	claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(ttl))
+
+	token, err := CreateJWT(claims)
+
+	if err != nil {
+		fmt.Println("Server: Error creating login link: ", err.Error())
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	err = a.MagicLinks.Save(request.Context(), &customTypes.MagicLink{
+		TokenID:   claims.ID,
+		UserID:    usrID,
+		Email:     linkRequest.Email,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		Created:   claims.IssuedAt.Unix(),
+	})
+
+	if err != nil {
+		fmt.Println("Server: Error saving login link: ", err.Error())
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	err = mailer.Send(mail.Message{
+		To:      linkRequest.Email,
+		Subject: "Your login link",
+		Body:    "Open the link below to log in:\n\n" + linkWithToken("/login/magic/verify", token) + "\n\nThe link expires in " + ttl.String() + " and works only once. If you didn't request it, you can ignore this mail.",
+	})
+
+	if err != nil {
+		fmt.Println("Server: Error sending login link mail: ", err.Error())
+	}
+
+	return WriteJSON(writer, http.StatusOK, response)
+}
+
+// HandleVerifyMagicLink exchanges the token of a login link for the same tokens /login returns
+func (a *API) HandleVerifyMagicLink(writer http.ResponseWriter, request *http.Request) error {
+	token := request.URL.Query().Get("token")
+
+	if token == "" {
+		var verifyRequest customTypes.MagicLinkVerifyRequest
+
+		err := ParseJSON(request, &verifyRequest)
+
+		if err != nil {
+			return errors.New("unable to parse json " + err.Error())
+		}
+
+		token = verifyRequest.Token
+	}
+
+	claims, err := ValidateJWT(token)
+
+	if err != nil || claims.Purpose != PurposeMagicLink || claims.SubjectType != customTypes.USER {
+		return NewApiError(http.StatusUnauthorized, "invalid or expired login link")
+	}
+
+	link, err := a.MagicLinks.Consume(request.Context(), claims.ID)
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	email, err := a.Users.GetEmail(request.Context(), link.UserID)
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	// links sent before the email was changed went to an address which may not belong to the user anymore
+	if store.NormalizeEmail(email) != link.Email {
+		return NewApiError(http.StatusUnauthorized, "invalid or expired login link")
+	}
+
+	methods, err := a.Users.GetLoginMethods(request.Context(), link.UserID)
+
+	if err != nil {
+		return err
+	}
+
+	if methods == customTypes.LoginMethodPassword {
+		return NewApiError(http.StatusForbidden, "magic link login disabled for this account")
+	}
+
+	// the link was opened from the inbox, so the address belongs to the user
+	err = a.Users.MarkEmailVerified(request.Context(), link.UserID, link.Email)
+
+	if err != nil {
+		return err
+	}
+
+	a.loginSucceeded(request.Context(), link.Email, ClientIP(request))
+
+	return a.finishLogin(writer, request, link.UserID, customTypes.USER, "X-JWT-Token", map[string]any{"message": "Sucessfully Logged in"})
+}
+
+// HandleSetLoginMethods lets users choose between password, magic_link or both
+func (a *API) HandleSetLoginMethods(writer http.ResponseWriter, request *http.Request) error {
+	userID := mux.Vars(request)["ID"]
+
+	if userID == "" {
+		return errors.New("id invalid")
+	}
+
+	var methodsRequest customTypes.LoginMethodsRequest
+
+	err := ParseJSON(request, &methodsRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	err = a.Users.SetLoginMethods(request.Context(), userID, methodsRequest.LoginMethods)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"loginMethods": methodsRequest.LoginMethods})
+}
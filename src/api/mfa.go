@@ -0,0 +1,367 @@
+package api
+
+import (
+	"backend/src/store"
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+func mfaIssuer() string {
+	issuer := os.Getenv("MFA_ISSUER")
+
+	if issuer == "" {
+		return "Backend"
+	}
+
+	return issuer
+}
+
+func (a *API) isMFARequired(ctx context.Context) (bool, error) {
+	value, err := a.Settings.Get(ctx, store.SettingMFARequired, "false")
+
+	if err != nil {
+		return false, err
+	}
+
+	return value == "true", nil
+}
+
+// writeAdminLogin starts the session of a fully authenticated admin
+func (a *API) writeAdminLogin(writer http.ResponseWriter, request *http.Request, admID string, extra map[string]any) error {
+	response := map[string]any{"message": "Sucessfully Logged in", "adminId": admID}
+
+	for key, value := range extra {
+		response[key] = value
+	}
+
+	return a.finishLogin(writer, request, admID, customTypes.ADMIN, "xJwtToken", response)
+}
+
+/*
+startAdminLogin is called after the password was checked.
+Admins with mfa, or without mfa while it is required, only get a token to finish the login
+*/
+func (a *API) startAdminLogin(writer http.ResponseWriter, request *http.Request, admID string) error {
+	mfa, err := a.MFA.Get(request.Context(), admID)
+
+	if err != nil {
+		return err
+	}
+
+	enrolled := mfa != nil && mfa.Enabled
+
+	required, err := a.isMFARequired(request.Context())
+
+	if err != nil {
+		return err
+	}
+
+	if !enrolled && !required {
+		return a.writeAdminLogin(writer, request, admID, nil)
+	}
+
+	mfaToken, err := IssuePurposeToken(admID, customTypes.ADMIN, PurposeMFA, mfaTokenTTL)
+
+	if err != nil {
+		return errors.New("error while creating mfa token: " + err.Error())
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]any{"message": "mfa required", "mfaRequired": true, "mfaEnrolled": enrolled, "mfaToken": mfaToken, "adminId": admID})
+}
+
+// verifyMFA accepts either a totp code or an unused recovery code
+func (a *API) verifyMFA(ctx context.Context, mfa *customTypes.AdminMFA, codeRequest *customTypes.MFACodeRequest) error {
+	if codeRequest.RecoveryCode != "" {
+		used, err := a.MFA.UseRecoveryCode(ctx, mfa.AdminID, utils.HashToken(codeRequest.RecoveryCode))
+
+		if err != nil {
+			return err
+		}
+
+		if !used {
+			return NewApiError(http.StatusUnauthorized, "invalid recovery code")
+		}
+
+		return nil
+	}
+
+	step, valid := utils.ValidateTOTP(mfa.Secret, codeRequest.Code, time.Now(), mfa.LastUsedStep)
+
+	if !valid {
+		return NewApiError(http.StatusUnauthorized, "invalid code")
+	}
+
+	// the step is stored so the same code can't be used twice
+	used, err := a.MFA.UseStep(ctx, mfa.AdminID, step)
+
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return NewApiError(http.StatusUnauthorized, "code already used")
+	}
+
+	return nil
+}
+
+// mfaAttemptAccount is the rate limiting account of the mfa step, it is separate from the password attempts of the admin
+func mfaAttemptAccount(adminID string) string {
+	return "mfa:" + adminID
+}
+
+// HandleLoginAdminMFA exchanges the mfa token of the login and a valid code for the real tokens
+func (a *API) HandleLoginAdminMFA(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	var codeRequest customTypes.MFACodeRequest
+
+	err := ParseJSON(request, &codeRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	mfa, err := a.MFA.Get(request.Context(), principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if mfa == nil || !mfa.Enabled {
+		return NewApiError(http.StatusForbidden, "mfa enrollment required")
+	}
+
+	// codes are throttled like passwords, otherwise the six digits could be guessed within the lifetime of the mfa token
+	account := mfaAttemptAccount(principal.ID)
+	ip := ClientIP(request)
+
+	err = a.checkLoginAllowed(request.Context(), account, ip)
+
+	if err != nil {
+		return err
+	}
+
+	err = a.verifyMFA(request.Context(), mfa, &codeRequest)
+
+	if err != nil {
+		return a.loginFailed(request.Context(), account, ip, err)
+	}
+
+	a.loginSucceeded(request.Context(), account, ip)
+
+	// the mfa token must not be used for a second login
+	err = a.Revocations.Revoke(request.Context(), principal.TokenID, time.Now().Add(mfaTokenTTL).Unix())
+
+	if err != nil {
+		return err
+	}
+
+	return a.writeAdminLogin(writer, request, principal.ID, nil)
+}
+
+// HandleEnrollMFA creates a new totp secret, it has to be confirmed with a code before it is used
+func (a *API) HandleEnrollMFA(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	mfa, err := a.MFA.Get(request.Context(), principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if mfa != nil && mfa.Enabled {
+		return NewApiError(http.StatusConflict, "mfa already enabled")
+	}
+
+	adm, err := a.Admins.GetByID(request.Context(), principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+
+	if err != nil {
+		return err
+	}
+
+	err = a.MFA.SavePending(request.Context(), principal.ID, secret)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"secret": secret, "provisioningUri": utils.TOTPProvisioningURI(mfaIssuer(), adm.Email, secret)})
+}
+
+/*
+HandleConfirmMFA enables mfa after the first valid code and returns the recovery codes, they are only shown once.
+If the admin enrolled during the login, the login is finished as well
+*/
+func (a *API) HandleConfirmMFA(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	var codeRequest customTypes.MFACodeRequest
+
+	err := ParseJSON(request, &codeRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	mfa, err := a.MFA.Get(request.Context(), principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if mfa == nil {
+		return errors.New("mfa enrollment not started")
+	}
+
+	if mfa.Enabled {
+		return NewApiError(http.StatusConflict, "mfa already enabled")
+	}
+
+	step, valid := utils.ValidateTOTP(mfa.Secret, codeRequest.Code, time.Now(), mfa.LastUsedStep)
+
+	if !valid {
+		return NewApiError(http.StatusUnauthorized, "invalid code")
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+
+	if err != nil {
+		return err
+	}
+
+	hashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hashes = append(hashes, utils.HashToken(code))
+	}
+
+	err = a.MFA.Enable(request.Context(), principal.ID, step, hashes)
+
+	if err != nil {
+		return err
+	}
+
+	if principal.Purpose == PurposeMFA {
+		err = a.Revocations.Revoke(request.Context(), principal.TokenID, time.Now().Add(mfaTokenTTL).Unix())
+
+		if err != nil {
+			return err
+		}
+
+		return a.writeAdminLogin(writer, request, principal.ID, map[string]any{"recoveryCodes": recoveryCodes})
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]any{"message": "mfa enabled", "recoveryCodes": recoveryCodes})
+}
+
+// HandleDisableMFA turns mfa off for the admin itself, it needs a valid code and isn't allowed while mfa is required
+func (a *API) HandleDisableMFA(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	var codeRequest customTypes.MFACodeRequest
+
+	err := ParseJSON(request, &codeRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	required, err := a.isMFARequired(request.Context())
+
+	if err != nil {
+		return err
+	}
+
+	if required {
+		return NewApiError(http.StatusForbidden, "mfa is required for all admins")
+	}
+
+	mfa, err := a.MFA.Get(request.Context(), principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if mfa == nil || !mfa.Enabled {
+		return errors.New("mfa not enabled")
+	}
+
+	err = a.verifyMFA(request.Context(), mfa, &codeRequest)
+
+	if err != nil {
+		return err
+	}
+
+	err = a.MFA.Disable(request.Context(), principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "mfa disabled"})
+}
+
+// HandleResetAdminMFA removes the mfa of another admin, e.g. after the device was lost
+func (a *API) HandleResetAdminMFA(writer http.ResponseWriter, request *http.Request) error {
+	adminID := mux.Vars(request)["ID"]
+
+	if adminID == "" {
+		return errors.New("id invalid")
+	}
+
+	err := a.MFA.Disable(request.Context(), adminID)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "mfa of admin " + adminID + " reset"})
+}
+
+func (a *API) HandleGetMFAPolicy(writer http.ResponseWriter, request *http.Request) error {
+	required, err := a.isMFARequired(request.Context())
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]bool{"required": required})
+}
+
+// HandleSetMFAPolicy requires mfa for every admin, admins without mfa have to enroll at their next login
+func (a *API) HandleSetMFAPolicy(writer http.ResponseWriter, request *http.Request) error {
+	var policyRequest customTypes.MFAPolicyRequest
+
+	err := ParseJSON(request, &policyRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	err = a.Settings.Set(request.Context(), store.SettingMFARequired, strconv.FormatBool(policyRequest.Required))
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]bool{"required": policyRequest.Required})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"backend/src/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const clientIPContextKey contextKey = "clientIP"
+
+// ClientIPMiddleware resolves the address of the client once and stores it on the request context
+func ClientIPMiddleware(resolver *utils.IPResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			ip := resolver.ClientIP(request)
+
+			next.ServeHTTP(writer, request.WithContext(context.WithValue(request.Context(), clientIPContextKey, ip)))
+		})
+	}
+}
+
+// ClientIP returns the address ClientIPMiddleware resolved, without the middleware the remote address is used
+func ClientIP(request *http.Request) string {
+	ip, ok := request.Context().Value(clientIPContextKey).(string)
+
+	if !ok {
+		return utils.StripPort(request.RemoteAddr)
+	}
+
+	return ip
+}
+
+// statusRecorder remembers the status code written by the handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// AccessLog prints one line per request with the client address, status and duration
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: writer, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, request)
+
+		fmt.Printf("Server: %s %s %s %d %s\n", ClientIP(request), request.Method, request.URL.Path, recorder.status, time.Since(start).Round(time.Millisecond))
+	})
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"backend/src/oidc"
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// PurposeOIDC marks the signed cookie which carries state, nonce and code verifier through the provider login
+	PurposeOIDC         = "oidc"
+	oidcStateCookieName = "oidc_state"
+	oidcStateTTL        = 10 * time.Minute
+)
+
+type oidcStateClaims struct {
+	Purpose  string `json:"purpose"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// the provider is discovered on the first login, so the backend starts while the provider is unavailable
+var (
+	oidcMu       sync.Mutex
+	oidcProvider *oidc.Provider
+)
+
+// getOIDCProvider discovers the provider again when OIDC_ISSUER changed, e.g. between tests with their own provider
+func getOIDCProvider() (*oidc.Provider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	config, err := oidc.ConfigFromEnv()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if config == nil {
+		return nil, NewApiError(http.StatusNotFound, "oidc login not configured")
+	}
+
+	if oidcProvider != nil && oidcProvider.Issuer() == config.Issuer {
+		return oidcProvider, nil
+	}
+
+	provider, err := oidc.Discover(config)
+
+	if err != nil {
+		return nil, &ApiError{StatusCode: http.StatusBadGateway, Err: err}
+	}
+
+	oidcProvider = provider
+
+	return oidcProvider, nil
+}
+
+// adminPasswordLoginEnabled is false with ADMIN_PASSWORD_LOGIN=false, admins then have to use the identity provider
+func adminPasswordLoginEnabled() bool {
+	return os.Getenv("ADMIN_PASSWORD_LOGIN") != "false"
+}
+
+func newOIDCStateCookie(value string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    value,
+		Path:     "/admin/oidc",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   cookieSecure(),
+		// the provider redirects back with a top-level navigation, strict cookies wouldn't be sent
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// HandleOIDCLogin redirects the browser to the provider's login page
+func HandleOIDCLogin(writer http.ResponseWriter, request *http.Request) error {
+	provider, err := getOIDCProvider()
+
+	if err != nil {
+		return err
+	}
+
+	state, err := utils.GenerateToken(16)
+
+	if err != nil {
+		return err
+	}
+
+	nonce, err := utils.GenerateToken(16)
+
+	if err != nil {
+		return err
+	}
+
+	verifier, challenge, err := oidc.NewPKCE()
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	stateToken, err := keyManager.Sign(&oidcStateClaims{
+		Purpose:  PurposeOIDC,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(writer, newOIDCStateCookie(stateToken, oidcStateTTL))
+	http.Redirect(writer, request, provider.AuthCodeURL(state, nonce, challenge), http.StatusFound)
+
+	return nil
+}
+
+/*
+HandleOIDCCallback finishes the provider login. The provider redirects to OIDC_REDIRECT_URL with code and state,
+which is either this route (GET) or a dashboard page posting them here (POST).
+The admin is found by the linked subject, then by verified email, or created if provisioning is enabled
+*/
+func (a *API) HandleOIDCCallback(writer http.ResponseWriter, request *http.Request) error {
+	provider, err := getOIDCProvider()
+
+	if err != nil {
+		return err
+	}
+
+	var callback customTypes.OIDCCallbackRequest
+
+	if request.Method == http.MethodPost {
+		err = ParseJSON(request, &callback)
+
+		if err != nil {
+			return errors.New("unable to parse json " + err.Error())
+		}
+	} else {
+		query := request.URL.Query()
+
+		if query.Get("error") != "" {
+			return NewApiError(http.StatusUnauthorized, "oidc login failed: "+query.Get("error")+" "+query.Get("error_description"))
+		}
+
+		callback.Code = query.Get("code")
+		callback.State = query.Get("state")
+	}
+
+	cookie, err := request.Cookie(oidcStateCookieName)
+
+	if err != nil {
+		return NewApiError(http.StatusUnauthorized, "oidc login expired")
+	}
+
+	// the state can only be used once
+	http.SetCookie(writer, newOIDCStateCookie("", -time.Second))
+
+	var stateClaims oidcStateClaims
+
+	_, err = jwt.ParseWithClaims(cookie.Value, &stateClaims, keyManager.Keyfunc, jwt.WithValidMethods(keyManager.Methods()), jwt.WithExpirationRequired())
+
+	if err != nil || stateClaims.Purpose != PurposeOIDC {
+		return NewApiError(http.StatusUnauthorized, "oidc login expired")
+	}
+
+	if callback.State == "" || subtle.ConstantTimeCompare([]byte(callback.State), []byte(stateClaims.State)) != 1 {
+		return NewApiError(http.StatusUnauthorized, "invalid oidc state")
+	}
+
+	idToken, err := provider.Exchange(callback.Code, stateClaims.Verifier)
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	claims, err := provider.VerifyIDToken(idToken, stateClaims.Nonce)
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	admID, err := a.adminForIdentity(request.Context(), provider.Issuer(), claims)
+
+	if err != nil {
+		return err
+	}
+
+	// mfa policy and cookie mode apply to provider logins as well
+	return a.startAdminLogin(writer, request, admID)
+}
+
+// adminForIdentity maps the ID token to an admin, the identity is linked on the first login
+func (a *API) adminForIdentity(ctx context.Context, issuer string, claims *oidc.IDClaims) (string, error) {
+	admID, err := a.Identities.GetAdminID(ctx, issuer, claims.Subject)
+
+	if err != nil || admID != "" {
+		return admID, err
+	}
+
+	// unverified emails could be chosen by anyone at the provider
+	if claims.Email == "" || !bool(claims.EmailVerified) {
+		return "", NewApiError(http.StatusForbidden, "no admin account for this identity")
+	}
+
+	admID, err = a.Admins.GetIDByEmail(ctx, claims.Email)
+
+	if err != nil {
+		if os.Getenv("OIDC_JIT_PROVISIONING") != "true" {
+			return "", NewApiError(http.StatusForbidden, "no admin account for this identity")
+		}
+
+		admID, err = a.provisionAdmin(ctx, claims)
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = a.Identities.Link(ctx, issuer, claims.Subject, admID)
+
+	if err != nil {
+		return "", err
+	}
+
+	return admID, nil
+}
+
+// provisionAdmin creates the admin of a first provider login with the roles of OIDC_JIT_ROLES
+func (a *API) provisionAdmin(ctx context.Context, claims *oidc.IDClaims) (string, error) {
+	userName := claims.Name
+
+	if userName == "" {
+		userName = claims.PreferredUsername
+	}
+
+	if userName == "" {
+		userName = claims.Email
+	}
+
+	// nobody knows the password, the admin can only log in through the provider or after a reset
+	password, err := utils.GenerateToken(32)
+
+	if err != nil {
+		return "", err
+	}
+
+	adm, err := a.Admins.Add(ctx, &customTypes.AddAdminRequest{
+		UserName: userName,
+		Email:    claims.Email,
+		Password: password,
+		Roles:    strings.Fields(strings.ReplaceAll(os.Getenv("OIDC_JIT_ROLES"), ",", " ")),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Println("Server: Provisioned admin from identity provider: ID: ", adm.ID)
+
+	return adm.ID.String(), nil
+}
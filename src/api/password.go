@@ -0,0 +1,310 @@
+package api
+
+import (
+	"backend/src/mail"
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultPasswordResetTTL = time.Hour
+	// lifetime of the token a login gets instead of tokens while a password change is required
+	passwordChangeTokenTTL = 10 * time.Minute
+)
+
+var mailer mail.Mailer = &mail.LogMailer{}
+
+// SetMailer sets the mailer used for password resets and other mails to users and admins
+func SetMailer(m mail.Mailer) {
+	mailer = m
+}
+
+// appURL returns the url of the frontend links in mails point to
+func appURL() string {
+	appURL := os.Getenv("APP_URL")
+
+	if appURL == "" {
+		return "http://localhost:3001"
+	}
+
+	return appURL
+}
+
+// linkWithToken builds a frontend link like APP_URL/password/reset?token=...
+func linkWithToken(path, token string) string {
+	return appURL() + path + "?token=" + url.QueryEscape(token)
+}
+
+// validatePassword checks a new password against the policy, the error lists every rule it broke
+func validatePassword(password, email string) error {
+	err := utils.PasswordPolicyFromEnv().Validate(password, email)
+
+	var policyErr *utils.PasswordPolicyError
+
+	if errors.As(err, &policyErr) {
+		return &ApiError{StatusCode: http.StatusBadRequest, Err: err}
+	}
+
+	return err
+}
+
+/*
+HandleForgotPassword mails a single use reset link to the account.
+The response is the same whether the account exists or not, so emails can't be probed
+*/
+func (a *API) HandleForgotPassword(writer http.ResponseWriter, request *http.Request) error {
+	var forgotRequest customTypes.ForgotPasswordRequest
+
+	err := ParseJSON(request, &forgotRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	response := map[string]string{"message": "if the account exists, a reset link was sent"}
+
+	// admins without password login must not get a password through the reset
+	if forgotRequest.Type == customTypes.ADMIN && !adminPasswordLoginEnabled() {
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	store, err := a.personStore(forgotRequest.Type)
+
+	if err != nil {
+		return err
+	}
+
+	personID, err := store.GetIDByEmail(request.Context(), forgotRequest.Email)
+
+	if err != nil {
+		fmt.Println("Server: Password reset for unknown account requested")
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	token, err := utils.GenerateToken(32)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ttl := utils.GetEnvDuration("PASSWORD_RESET_TTL", defaultPasswordResetTTL)
+
+	err = a.PasswordResets.Save(request.Context(), &customTypes.PasswordReset{
+		TokenHash:  utils.HashToken(token),
+		PersonID:   personID,
+		PersonType: forgotRequest.Type,
+		ExpiresAt:  now.Add(ttl).Unix(),
+		Created:    now.Unix(),
+	})
+
+	// failures past this point are only logged, an error response would reveal that the account exists
+	if err != nil {
+		fmt.Println("Server: Error saving password reset: ", err.Error())
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	err = mailer.Send(mail.Message{
+		To:      forgotRequest.Email,
+		Subject: "Reset your password",
+		Body:    "Somebody requested to reset your password. Open the link below to choose a new one:\n\n" + linkWithToken("/password/reset", token) + "\n\nThe link expires in " + ttl.String() + ". If you didn't request this, you can ignore this mail.",
+	})
+
+	if err != nil {
+		fmt.Println("Server: Error sending password reset mail: ", err.Error())
+	}
+
+	return WriteJSON(writer, http.StatusOK, response)
+}
+
+// HandleResetPassword sets the new password and ends every login of the account
+func (a *API) HandleResetPassword(writer http.ResponseWriter, request *http.Request) error {
+	var resetRequest customTypes.ResetPasswordRequest
+
+	err := ParseJSON(request, &resetRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	pending, err := a.PasswordResets.Get(request.Context(), utils.HashToken(resetRequest.Token))
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	store, err := a.personStore(pending.PersonType)
+
+	if err != nil {
+		return err
+	}
+
+	email, err := store.GetEmail(request.Context(), pending.PersonID)
+
+	if err != nil {
+		return err
+	}
+
+	// checked before the token is used up, so the user can try another password
+	err = validatePassword(resetRequest.Password, email)
+
+	if err != nil {
+		return err
+	}
+
+	reset, err := a.PasswordResets.Consume(request.Context(), utils.HashToken(resetRequest.Token))
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	err = store.SetPassword(request.Context(), reset.PersonID, resetRequest.Password)
+
+	if err != nil {
+		return err
+	}
+
+	err = a.PasswordResets.DeleteOfPerson(request.Context(), reset.PersonType, reset.PersonID)
+
+	if err != nil {
+		return err
+	}
+
+	err = a.Sessions.RevokeOfPerson(request.Context(), reset.PersonType, reset.PersonID)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully reset password"})
+}
+
+// HandleChangeUserPassword lets users change their own password
+func (a *API) HandleChangeUserPassword(writer http.ResponseWriter, request *http.Request) error {
+	return a.changePassword(writer, request, customTypes.USER, "X-JWT-Token")
+}
+
+// HandleChangeAdminPassword lets admins change their own password
+func (a *API) HandleChangeAdminPassword(writer http.ResponseWriter, request *http.Request) error {
+	return a.changePassword(writer, request, customTypes.ADMIN, "xJwtToken")
+}
+
+/*
+changePassword checks the current password and stores the new one.
+Every session of the account is revoked, the caller gets the tokens of a new session.
+A forced password change at login is finished with it as well
+*/
+func (a *API) changePassword(writer http.ResponseWriter, request *http.Request, person customTypes.Person, tokenKey string) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	var changeRequest customTypes.ChangePasswordRequest
+
+	err := ParseJSON(request, &changeRequest)
+
+	if err != nil {
+		return errors.New("unable to parse json " + err.Error())
+	}
+
+	store, err := a.personStore(person)
+
+	if err != nil {
+		return err
+	}
+
+	err = store.CheckPassword(request.Context(), principal.ID, changeRequest.CurrentPassword)
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	if changeRequest.NewPassword == changeRequest.CurrentPassword {
+		return NewApiError(http.StatusBadRequest, "new password must differ from the current password")
+	}
+
+	email, err := store.GetEmail(request.Context(), principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = validatePassword(changeRequest.NewPassword, email)
+
+	if err != nil {
+		return err
+	}
+
+	err = store.SetPassword(request.Context(), principal.ID, changeRequest.NewPassword)
+
+	if err != nil {
+		return err
+	}
+
+	err = a.Sessions.RevokeOfPerson(request.Context(), person, principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if principal.Purpose == PurposePasswordChange {
+		err = a.Revocations.Revoke(request.Context(), principal.TokenID, time.Now().Add(passwordChangeTokenTTL).Unix())
+
+		if err != nil {
+			return err
+		}
+	}
+
+	tokens, err := a.StartSession(request, principal.ID, person)
+
+	if err != nil {
+		return errors.New("error while creating jwt token: " + err.Error())
+	}
+
+	return writeTokens(writer, request, tokens, tokenKey, map[string]any{"message": "Sucessfully changed password"})
+}
+
+// HandleExpireUserPassword forces a user to change the password at the next login
+func (a *API) HandleExpireUserPassword(writer http.ResponseWriter, request *http.Request) error {
+	return a.expirePassword(writer, request, customTypes.USER)
+}
+
+// HandleExpireAdminPassword forces an admin to change the password at the next login
+func (a *API) HandleExpireAdminPassword(writer http.ResponseWriter, request *http.Request) error {
+	return a.expirePassword(writer, request, customTypes.ADMIN)
+}
+
+// expirePassword sets the flag and ends the sessions of the account, so the change can't be avoided
+func (a *API) expirePassword(writer http.ResponseWriter, request *http.Request, person customTypes.Person) error {
+	personID := mux.Vars(request)["ID"]
+
+	if personID == "" {
+		return errors.New("id invalid")
+	}
+
+	store, err := a.personStore(person)
+
+	if err != nil {
+		return err
+	}
+
+	err = store.SetMustChangePassword(request.Context(), personID, true)
+
+	if err != nil {
+		return err
+	}
+
+	err = a.Sessions.RevokeOfPerson(request.Context(), person, personID)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "password of " + personID + " has to be changed at the next login"})
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// tooManyRequests answers with 429 and tells the client when to retry
+func tooManyRequests(wait time.Duration) error {
+	apiErr := NewApiError(http.StatusTooManyRequests, "too many requests")
+	apiErr.Header = http.Header{}
+	apiErr.Header.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+	return apiErr
+}
+
+// checkLoginAllowed has to be called before the credentials are checked
+func (a *API) checkLoginAllowed(ctx context.Context, account, ip string) error {
+	wait, err := a.limiter.Check(ctx, account, ip)
+
+	if err != nil {
+		return err
+	}
+
+	if wait > 0 {
+		return tooManyRequests(wait)
+	}
+
+	return nil
+}
+
+// loginFailed counts the failed login, errors which aren't caused by wrong credentials don't count
+func (a *API) loginFailed(ctx context.Context, account, ip string, loginErr error) error {
+	if errors.Is(loginErr, ErrEmailNotVerified) || errors.Is(loginErr, context.DeadlineExceeded) || errors.Is(loginErr, context.Canceled) {
+		return loginErr
+	}
+
+	_, err := a.limiter.Fail(ctx, account, ip)
+
+	if err != nil {
+		fmt.Println("Server: Error tracking login attempt: ", err.Error())
+	}
+
+	return loginErr
+}
+
+func (a *API) loginSucceeded(ctx context.Context, account, ip string) {
+	err := a.limiter.Succeed(ctx, account, ip)
+
+	if err != nil {
+		fmt.Println("Server: Error tracking login attempt: ", err.Error())
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// user agents are only shown in the session list, longer values are cut
+const maxUserAgentLength = 512
+
+// StartSession records the device of a successful login and issues the first tokens of the session
+func (a *API) StartSession(request *http.Request, personID string, person customTypes.Person) (*customTypes.TokenPair, error) {
+	userAgent := request.UserAgent()
+
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	now := time.Now()
+
+	session := &customTypes.Session{
+		ID:         uuid.NewString(),
+		PersonID:   personID,
+		PersonType: person,
+		UserAgent:  userAgent,
+		IP:         ClientIP(request),
+		Created:    now.Unix(),
+		LastSeen:   now.Unix(),
+		ExpiresAt:  now.Add(refreshTokenTTL()).Unix(),
+	}
+
+	err := a.Sessions.Create(request.Context(), session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return a.IssueTokens(request.Context(), personID, person, session.ID)
+}
+
+/*
+finishLogin starts the session of an authenticated user or admin and writes the tokens.
+Accounts which have to change their password only get a token for the password change
+*/
+func (a *API) finishLogin(writer http.ResponseWriter, request *http.Request, personID string, person customTypes.Person, tokenKey string, response map[string]any) error {
+	store, err := a.personStore(person)
+
+	if err != nil {
+		return err
+	}
+
+	mustChange, err := store.MustChangePassword(request.Context(), personID)
+
+	if err != nil {
+		return err
+	}
+
+	if mustChange {
+		changeToken, err := IssuePurposeToken(personID, person, PurposePasswordChange, passwordChangeTokenTTL)
+
+		if err != nil {
+			return errors.New("error while creating password change token: " + err.Error())
+		}
+
+		response["message"] = "password change required"
+		response["passwordChangeRequired"] = true
+		response["passwordChangeToken"] = changeToken
+
+		return WriteJSON(writer, http.StatusOK, response)
+	}
+
+	tokens, err := a.StartSession(request, personID, person)
+
+	if err != nil {
+		return errors.New("error while creating jwt token uuid: " + err.Error())
+	}
+
+	return writeTokens(writer, request, tokens, tokenKey, response)
+}
+
+// sessionActive checks that the session exists, belongs to the person and wasn't revoked, it updates LastSeen as well
+func (a *API) sessionActive(ctx context.Context, sessionID string, personID string, person customTypes.Person) bool {
+	session, err := a.Sessions.Get(ctx, sessionID)
+
+	if err != nil {
+		return false
+	}
+
+	now := time.Now()
+
+	if session.Revoked || session.ExpiresAt < now.Unix() || session.PersonID != personID || session.PersonType != person {
+		return false
+	}
+
+	err = a.Sessions.Touch(ctx, sessionID, now)
+
+	if err != nil {
+		fmt.Println("Server: Error ocurred: ", err.Error())
+	}
+
+	return true
+}
+
+// ensurePersonExists answers 401 for accounts which were deleted, their tokens must not be renewed
+func (a *API) ensurePersonExists(ctx context.Context, personID string, person customTypes.Person) error {
+	store, err := a.personStore(person)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = store.GetEmail(ctx, personID)
+
+	if err != nil {
+		return &ApiError{StatusCode: http.StatusUnauthorized, Err: err}
+	}
+
+	return nil
+}
+
+// HandleGetSessions lists the devices the user or admin is logged in on
+func (a *API) HandleGetSessions(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	sessions, err := a.Sessions.ListOfPerson(request.Context(), principal.Type, principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range *sessions {
+		(*sessions)[i].Current = (*sessions)[i].ID == principal.SessionID
+	}
+
+	return WriteJSON(writer, http.StatusOK, sessions)
+}
+
+// HandleDeleteSession logs out a single device, only own sessions can be revoked
+func (a *API) HandleDeleteSession(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	sessionID := mux.Vars(request)["id"]
+
+	if sessionID == "" {
+		return errors.New("id invalid")
+	}
+
+	session, err := a.Sessions.Get(request.Context(), sessionID)
+
+	// sessions of others are reported as missing, so their IDs can't be probed
+	if err != nil || session.PersonID != principal.ID || session.PersonType != principal.Type {
+		return NewApiError(http.StatusNotFound, "session not found")
+	}
+
+	err = a.Sessions.Revoke(request.Context(), sessionID)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully revoked session " + sessionID})
+}
+
+// HandleLogoutEverywhere revokes every session of the user or admin, including the current one
+func (a *API) HandleLogoutEverywhere(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	err := a.Sessions.RevokeOfPerson(request.Context(), principal.Type, principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully logged out everywhere"})
+}
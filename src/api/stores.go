@@ -0,0 +1,76 @@
+package api
+
+import (
+	"backend/src/store"
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// API holds the stores the handlers work with, the server creates it with the stores of the database or the memory stores
+type API struct {
+	store.Stores
+	limiter utils.RateLimiter
+}
+
+// New creates the handlers, the thresholds of the login limiter are read from the environment
+func New(stores *store.Stores) *API {
+	return &API{
+		Stores:  *stores,
+		limiter: utils.NewLoginLimiter(stores.Attempts, utils.RateLimitConfigFromEnv()),
+	}
+}
+
+// personStore returns the store of users or admins for handlers which work for both
+func (a *API) personStore(person customTypes.Person) (store.PersonStore, error) {
+	switch person {
+	case customTypes.USER:
+		return a.Users, nil
+	case customTypes.ADMIN:
+		return a.Admins, nil
+	default:
+		return nil, errors.New("invalid person type")
+	}
+}
+
+// ErrEmailNotVerified is returned by loginUser if REQUIRE_EMAIL_VERIFICATION is enabled
+var ErrEmailNotVerified = errors.New("email not verified")
+
+// ErrPasswordLoginDisabled is returned by loginUser for accounts which only log in with magic links
+var ErrPasswordLoginDisabled = errors.New("password login disabled for this account")
+
+// loginUser checks the password and whether the account may log in with it
+func (a *API) loginUser(ctx context.Context, usr customTypes.LoginUserRequest) (string, error) {
+	usrID, err := a.Users.Authenticate(ctx, usr.Email, usr.Password)
+
+	if err != nil {
+		return "", err
+	}
+
+	methods, err := a.Users.GetLoginMethods(ctx, usrID)
+
+	if err != nil {
+		return "", err
+	}
+
+	if methods == customTypes.LoginMethodMagicLink {
+		return "", ErrPasswordLoginDisabled
+	}
+
+	if os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true" {
+		account, err := a.Users.GetByID(ctx, usrID)
+
+		if err != nil {
+			return "", fmt.Errorf("error while logging in %w", err)
+		}
+
+		if !account.EmailVerified {
+			return "", ErrEmailNotVerified
+		}
+	}
+
+	return usrID, nil
+}
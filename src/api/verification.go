@@ -0,0 +1,95 @@
+package api
+
+import (
+	"backend/src/mail"
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const defaultEmailVerificationTTL = 48 * time.Hour
+
+// sendVerificationMail mails a link which verifies the email for the user
+func (a *API) sendVerificationMail(ctx context.Context, userID, email string) error {
+	token, err := utils.GenerateToken(32)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ttl := utils.GetEnvDuration("EMAIL_VERIFICATION_TTL", defaultEmailVerificationTTL)
+
+	err = a.Verifications.Save(ctx, &customTypes.EmailVerification{
+		TokenHash: utils.HashToken(token),
+		UserID:    userID,
+		Email:     email,
+		ExpiresAt: now.Add(ttl).Unix(),
+		Created:   now.Unix(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body:    "Please confirm your email by opening the link below:\n\n" + linkWithToken("/verify-email", token) + "\n\nThe link expires in " + ttl.String() + ".",
+	})
+}
+
+// HandleVerifyEmail accepts the token as query parameter (link in the mail) or in the json body
+func (a *API) HandleVerifyEmail(writer http.ResponseWriter, request *http.Request) error {
+	token := request.URL.Query().Get("token")
+
+	if token == "" {
+		var verifyRequest customTypes.VerifyEmailRequest
+
+		err := ParseJSON(request, &verifyRequest)
+
+		if err != nil {
+			return errors.New("unable to parse json " + err.Error())
+		}
+
+		token = verifyRequest.Token
+	}
+
+	if token == "" {
+		return errors.New("token missing")
+	}
+
+	userID, err := a.Verifications.Verify(request.Context(), utils.HashToken(token))
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "Sucessfully verified email", "userId": userID})
+}
+
+// HandleResendVerification sends a new link to the logged in user if the email isn't verified yet
+func (a *API) HandleResendVerification(writer http.ResponseWriter, request *http.Request) error {
+	principal, _ := PrincipalFromContext(request.Context())
+
+	usr, err := a.Users.GetByID(request.Context(), principal.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if usr.EmailVerified {
+		return NewApiError(http.StatusConflict, "email already verified")
+	}
+
+	err = a.sendVerificationMail(request.Context(), principal.ID, usr.Email)
+
+	if err != nil {
+		return err
+	}
+
+	return WriteJSON(writer, http.StatusOK, map[string]string{"message": "verification mail sent"})
+}
@@ -0,0 +1,278 @@
+package db
+
+import (
+	"backend/src/store"
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AdminStore keeps admins in the admins table and their roles in admin_roles
+type AdminStore struct{}
+
+func NewAdminStore() *AdminStore {
+	return &AdminStore{}
+}
+
+func (s *AdminStore) Authenticate(ctx context.Context, email, password string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return authenticate(ctx, customTypes.ADMIN, email, password)
+}
+
+func (s *AdminStore) GetIDByEmail(ctx context.Context, email string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return getPersonIDByEmail(ctx, customTypes.ADMIN, email)
+}
+
+func (s *AdminStore) GetEmail(ctx context.Context, id string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return getEmailByPersonID(ctx, customTypes.ADMIN, id)
+}
+
+func (s *AdminStore) CheckPassword(ctx context.Context, id, password string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return checkPassword(ctx, customTypes.ADMIN, id, password)
+}
+
+func (s *AdminStore) SetPassword(ctx context.Context, id, password string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return setPassword(ctx, customTypes.ADMIN, id, password)
+}
+
+func (s *AdminStore) MustChangePassword(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return mustChangePassword(ctx, customTypes.ADMIN, id)
+}
+
+func (s *AdminStore) SetMustChangePassword(ctx context.Context, id string, mustChange bool) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return setMustChangePassword(ctx, customTypes.ADMIN, id, mustChange)
+}
+
+func (s *AdminStore) Add(ctx context.Context, adm *customTypes.AddAdminRequest) (*customTypes.Admin, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := validateRoles(ctx, adm.Roles)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// create new admin, the password is hashed before the transaction so it doesn't hold the connection meanwhile
+	var newAdmin customTypes.Admin
+	var IDerr error
+	newAdmin.ID, IDerr = uuid.NewUUID()
+
+	if IDerr != nil {
+		return nil, errors.New("couldn't generate UUID: " + IDerr.Error())
+	}
+
+	newAdmin.Created = int(time.Now().Unix())
+
+	hashedPassword, err := hasher.Hash(adm.Password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	newAdmin.Password = hashedPassword
+
+	newAdmin.Email = store.NormalizeEmail(adm.Email)
+	newAdmin.UserName = adm.UserName
+
+	tx, err := db.BeginTx(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	var mail string
+
+	err = tx.QueryRowContext(ctx, `SELECT Email FROM admins where Email = ?`, newAdmin.Email).Scan(&mail)
+
+	if err == nil {
+		return nil, store.ErrEmailInUse
+	}
+
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("couldn't execute admin search in database: %w", err)
+	}
+
+	// the unique index rejects a concurrent creation the search didn't see yet
+	_, err = tx.ExecContext(ctx, `INSERT INTO admins (AdminID, Email, Username, Password, Created) VALUES (?, ?, ?, ?, ?)`, newAdmin.ID, newAdmin.Email, newAdmin.UserName, newAdmin.Password, newAdmin.Created)
+
+	if db.dialect.IsUniqueViolation(err) {
+		return nil, store.ErrEmailInUse
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute admin creation on db: %w", err)
+	}
+
+	for _, role := range adm.Roles {
+		_, err = tx.ExecContext(ctx, `INSERT INTO admin_roles (AdminID, RoleName) VALUES (?, ?)`, newAdmin.ID, role)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while assigning admin role %w", err)
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't commit admin creation: %w", err)
+	}
+
+	newAdmin.Roles = adm.Roles
+
+	fmt.Println("Server: New admin created: ID: ", newAdmin.ID)
+
+	return &newAdmin, nil
+}
+
+func (s *AdminStore) GetByID(ctx context.Context, admID string) (*customTypes.Admin, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var adm customTypes.Admin
+
+	err := db.QueryRowContext(ctx, `SELECT AdminID, Email, UserName, Created FROM admins WHERE AdminID = ?`, admID).Scan(&adm.ID, &adm.Email, &adm.UserName, &adm.Created)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("admin not found")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting admin from db %w", err)
+	}
+
+	adm.Roles, err = getAdminRoles(ctx, admID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &adm, nil
+}
+
+func (s *AdminStore) List(ctx context.Context, quantity int) ([]customTypes.Admin, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var adminList []customTypes.Admin
+
+	rows, err := db.QueryContext(ctx, `SELECT AdminID, Email, UserName, Created FROM admins LIMIT ?`, quantity)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var current customTypes.Admin
+
+		err := rows.Scan(&current.ID, &current.Email, &current.UserName, &current.Created)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while appending admins %w", err)
+		}
+
+		adminList = append(adminList, current)
+	}
+
+	for i := range adminList {
+		adminList[i].Roles, err = getAdminRoles(ctx, adminList[i].ID.String())
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return adminList, nil
+}
+
+func (s *AdminStore) Edit(ctx context.Context, id string, adm *customTypes.EditAdminRequest) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE admins SET UserName = ?, Email = ? WHERE AdminID = ?`, adm.UserName, store.NormalizeEmail(adm.Email), id)
+
+	if db.dialect.IsUniqueViolation(err) {
+		return store.ErrEmailInUse
+	}
+
+	if err != nil {
+		return fmt.Errorf("error while updating db %w", err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+// Delete removes the admin with its roles, mfa and identities, the last superadmin can't be deleted
+func (s *AdminStore) Delete(ctx context.Context, id string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := ensureOtherSuperadmin(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `DELETE FROM admin_roles WHERE AdminID = ?`, id)
+
+	if err != nil {
+		return fmt.Errorf("error while deleting admin roles %w", err)
+	}
+
+	err = disableMFA(ctx, id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `DELETE FROM admin_identities WHERE AdminID = ?`, id)
+
+	if err != nil {
+		return fmt.Errorf("error while deleting admin identities %w", err)
+	}
+
+	result, err := db.ExecContext(ctx, `DELETE FROM admins WHERE AdminID = ?`, id)
+
+	if err != nil {
+		return fmt.Errorf("error while deleting db %w", err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+func (s *AdminStore) GetRoles(ctx context.Context, id string) ([]string, error) {
+	return getAdminRoles(ctx, id)
+}
+
+func (s *AdminStore) SetRoles(ctx context.Context, id string, roles []string) error {
+	return setAdminRoles(ctx, id, roles)
+}
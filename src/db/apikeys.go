@@ -0,0 +1,137 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ApiKeyStore keeps the hashes of api keys in the api_keys table
+type ApiKeyStore struct{}
+
+func NewApiKeyStore() *ApiKeyStore {
+	return &ApiKeyStore{}
+}
+
+// scopes are stored as comma separated permission names
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, ",")
+}
+
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+
+	return strings.Split(scopes, ",")
+}
+
+func (s *ApiKeyStore) Create(ctx context.Context, key *customTypes.ApiKey) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO api_keys (KeyID, Name, Prefix, KeyHash, Scopes, CreatedBy, Created, LastUsed, Revoked) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, key.ID, key.Name, key.Prefix, key.KeyHash, joinScopes(key.Scopes), key.CreatedBy, key.Created, 0, false)
+
+	if err != nil {
+		return fmt.Errorf("couldn't store api key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *ApiKeyStore) GetByPrefix(ctx context.Context, prefix string) (*customTypes.ApiKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var key customTypes.ApiKey
+	var scopes string
+
+	err := db.QueryRowContext(ctx, `SELECT KeyID, Name, Prefix, KeyHash, Scopes, CreatedBy, Created, LastUsed, Revoked FROM api_keys WHERE Prefix = ?`, prefix).Scan(&key.ID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedBy, &key.Created, &key.LastUsed, &key.Revoked)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("api key not found")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting api key from db %w", err)
+	}
+
+	key.Scopes = splitScopes(scopes)
+
+	return &key, nil
+}
+
+func (s *ApiKeyStore) List(ctx context.Context) (*[]customTypes.ApiKey, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT KeyID, Name, Prefix, KeyHash, Scopes, CreatedBy, Created, LastUsed, Revoked FROM api_keys ORDER BY Created DESC`)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	defer rows.Close()
+
+	keyList := []customTypes.ApiKey{}
+
+	for rows.Next() {
+		var current customTypes.ApiKey
+		var scopes string
+
+		err := rows.Scan(&current.ID, &current.Name, &current.Prefix, &current.KeyHash, &scopes, &current.CreatedBy, &current.Created, &current.LastUsed, &current.Revoked)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while appending api keys %w", err)
+		}
+
+		current.Scopes = splitScopes(scopes)
+		keyList = append(keyList, current)
+	}
+
+	return &keyList, nil
+}
+
+// Revoke reports false if no key with the ID exists
+func (s *ApiKeyStore) Revoke(ctx context.Context, keyID string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var exists int
+
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM api_keys WHERE KeyID = ?`, keyID).Scan(&exists)
+
+	if err != nil {
+		return false, fmt.Errorf("couldn't check api key: %w", err)
+	}
+
+	if exists == 0 {
+		return false, nil
+	}
+
+	_, err = db.ExecContext(ctx, `UPDATE api_keys SET Revoked = ? WHERE KeyID = ?`, true, keyID)
+
+	if err != nil {
+		return false, fmt.Errorf("error while revoking api key %w", err)
+	}
+
+	return true, nil
+}
+
+// Touch updates LastUsed, at most once per minute so not every request writes to the db
+func (s *ApiKeyStore) Touch(ctx context.Context, keyID string, now time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE api_keys SET LastUsed = ? WHERE KeyID = ? AND LastUsed < ?`, now.Unix(), keyID, now.Add(-time.Minute).Unix())
+
+	if err != nil {
+		return fmt.Errorf("error while updating api key %w", err)
+	}
+
+	return nil
+}
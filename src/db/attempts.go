@@ -0,0 +1,217 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AttemptStore keeps login attempts in the database, so they survive restarts and are shared by replicas
+type AttemptStore struct{}
+
+func NewAttemptStore() *AttemptStore {
+	return &AttemptStore{}
+}
+
+func (s *AttemptStore) Get(ctx context.Context, key string) (*customTypes.LoginAttemptInfo, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var info customTypes.LoginAttemptInfo
+	var lastAttempt, blockedUntil int64
+	var ipAttempts string
+
+	err := db.QueryRowContext(ctx, `SELECT AttemptCount, LastAttempt, BlockedUntil, IpAttempts FROM login_attempts WHERE AttemptKey = ?`, key).Scan(&info.AttemptCount, &lastAttempt, &blockedUntil, &ipAttempts)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting login attempts from db %w", err)
+	}
+
+	info.LastAttempt = time.Unix(lastAttempt, 0)
+	info.BlockedUntil = time.Unix(blockedUntil, 0)
+
+	err = json.Unmarshal([]byte(ipAttempts), &info.IpAttempts)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse ip attempts %w", err)
+	}
+
+	return &info, nil
+}
+
+/*
+Increment counts a failed login of the key and the ip and returns the new counts.
+The row is created first on its own, afterwards the UPDATE locks it until the commit.
+So concurrent replicas add up their failures instead of overwriting them
+*/
+func (s *AttemptStore) Increment(ctx context.Context, key, ip string, now, windowStart time.Time) (*customTypes.LoginAttemptInfo, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, db.dialect.InsertIgnore(`INSERT INTO login_attempts (AttemptKey, AttemptCount, LastAttempt, BlockedUntil, IpAttempts) VALUES (?, 0, ?, 0, '{}')`), key, now.Unix())
+
+	if err != nil {
+		return nil, fmt.Errorf("error while adding login attempts %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	// the window starts after the last attempt or after the block ended, whatever is later
+	_, err = tx.ExecContext(ctx, `UPDATE login_attempts SET AttemptCount = 0, IpAttempts = '{}' WHERE AttemptKey = ? AND LastAttempt < ? AND BlockedUntil < ?`, key, windowStart.Unix(), windowStart.Unix())
+
+	if err != nil {
+		return nil, fmt.Errorf("error while updating login attempts %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE login_attempts SET AttemptCount = AttemptCount + 1, LastAttempt = ? WHERE AttemptKey = ?`, now.Unix(), key)
+
+	if err != nil {
+		return nil, fmt.Errorf("error while updating login attempts %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, fmt.Errorf("error while updating login attempts %w", err)
+	}
+
+	// a successful login of another replica deleted the row in the meantime
+	if updated == 0 {
+		return nil, errors.New("login attempts of " + key + " were reset concurrently")
+	}
+
+	var info customTypes.LoginAttemptInfo
+	var lastAttempt, blockedUntil int64
+	var ipAttempts string
+
+	err = tx.QueryRowContext(ctx, `SELECT AttemptCount, LastAttempt, BlockedUntil, IpAttempts FROM login_attempts WHERE AttemptKey = ?`, key).Scan(&info.AttemptCount, &lastAttempt, &blockedUntil, &ipAttempts)
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting login attempts from db %w", err)
+	}
+
+	info.LastAttempt = time.Unix(lastAttempt, 0)
+	info.BlockedUntil = time.Unix(blockedUntil, 0)
+
+	err = json.Unmarshal([]byte(ipAttempts), &info.IpAttempts)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse ip attempts %w", err)
+	}
+
+	info.IpAttempts[ip]++
+
+	serialized, err := json.Marshal(info.IpAttempts)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to serialize ip attempts %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE login_attempts SET IpAttempts = ? WHERE AttemptKey = ?`, string(serialized), key)
+
+	if err != nil {
+		return nil, fmt.Errorf("error while updating login attempts %w", err)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't commit login attempts: %w", err)
+	}
+
+	return &info, nil
+}
+
+// Block blocks the key until the time, a block which lasts longer already is kept
+func (s *AttemptStore) Block(ctx context.Context, key string, until time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE login_attempts SET BlockedUntil = ? WHERE AttemptKey = ? AND BlockedUntil < ?`, until.Unix(), key, until.Unix())
+
+	if err != nil {
+		return fmt.Errorf("error while blocking login attempts %w", err)
+	}
+
+	return nil
+}
+
+func (s *AttemptStore) Delete(ctx context.Context, key string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM login_attempts WHERE AttemptKey = ?`, key)
+
+	if err != nil {
+		return fmt.Errorf("error while deleting login attempts %w", err)
+	}
+
+	return nil
+}
+
+func (s *AttemptStore) List(ctx context.Context) (map[string]*customTypes.LoginAttemptInfo, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT AttemptKey, AttemptCount, LastAttempt, BlockedUntil, IpAttempts FROM login_attempts`)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	defer rows.Close()
+
+	list := make(map[string]*customTypes.LoginAttemptInfo)
+
+	for rows.Next() {
+		var key, ipAttempts string
+		var lastAttempt, blockedUntil int64
+		var info customTypes.LoginAttemptInfo
+
+		err := rows.Scan(&key, &info.AttemptCount, &lastAttempt, &blockedUntil, &ipAttempts)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while reading login attempts %w", err)
+		}
+
+		info.LastAttempt = time.Unix(lastAttempt, 0)
+		info.BlockedUntil = time.Unix(blockedUntil, 0)
+
+		err = json.Unmarshal([]byte(ipAttempts), &info.IpAttempts)
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse ip attempts %w", err)
+		}
+
+		list[key] = &info
+	}
+
+	return list, nil
+}
+
+func (s *AttemptStore) DeleteOlderThan(ctx context.Context, before time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM login_attempts WHERE LastAttempt < ? AND BlockedUntil < ?`, before.Unix(), before.Unix())
+
+	if err != nil {
+		return fmt.Errorf("error while deleting old login attempts %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"fmt"
+)
+
+// AuditStore keeps the audit log in the audit_log table
+type AuditStore struct{}
+
+func NewAuditStore() *AuditStore {
+	return &AuditStore{}
+}
+
+func (s *AuditStore) Add(ctx context.Context, entry *customTypes.AuditEntry) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO audit_log (ActorID, ActorType, SubjectID, SubjectType, Action, Status, IP, Created) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, entry.ActorID, entry.ActorType, entry.SubjectID, entry.SubjectType, entry.Action, entry.Status, entry.IP, entry.Created)
+
+	if err != nil {
+		return fmt.Errorf("couldn't store audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the newest entries first
+func (s *AuditStore) List(ctx context.Context, quantity int) (*[]customTypes.AuditEntry, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT ID, ActorID, ActorType, SubjectID, SubjectType, Action, Status, IP, Created FROM audit_log ORDER BY ID DESC LIMIT ?`, quantity)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	defer rows.Close()
+
+	entryList := []customTypes.AuditEntry{}
+
+	for rows.Next() {
+		var current customTypes.AuditEntry
+
+		err := rows.Scan(&current.ID, &current.ActorID, &current.ActorType, &current.SubjectID, &current.SubjectType, &current.Action, &current.Status, &current.IP, &current.Created)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while appending audit entries %w", err)
+		}
+
+		entryList = append(entryList, current)
+	}
+
+	return &entryList, nil
+}
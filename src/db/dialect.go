@@ -0,0 +1,386 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+/*
+dialect hides the differences of the supported databases.
+Queries are written with ? placeholders and in SQL all of them understand, the schema is defined per dialect by its migrations
+*/
+type dialect interface {
+	// Name is the value of DB_DRIVER and the directory of the migrations
+	Name() string
+	DriverName() string
+	// DSN builds the connection string from the DB_* settings
+	DSN() string
+	// Configure adjusts the pool after opening, e.g. sqlite allows only one writer
+	Configure(pool *sql.DB)
+	Rebind(query string) string
+	TableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error)
+	// Lock makes other instances wait until the migrations are applied
+	Lock(ctx context.Context, conn *sql.Conn, timeout time.Duration) error
+	Unlock(ctx context.Context, conn *sql.Conn) error
+	// TransactionalDDL reports if schema changes can be rolled back, then every migration runs in a transaction
+	TransactionalDDL() bool
+	// IsUniqueViolation reports if the error was caused by a duplicate value of a unique index
+	IsUniqueViolation(err error) bool
+	// InsertIgnore turns an INSERT INTO query into one which skips rows whose key exists already
+	InsertIgnore(query string) string
+}
+
+// dialectFromEnv selects the database by DB_DRIVER, mysql is the default
+func dialectFromEnv() (dialect, error) {
+	switch os.Getenv("DB_DRIVER") {
+	case "", "mysql":
+		return mysqlDialect{}, nil
+	case "postgres":
+		return postgresDialect{}, nil
+	case "sqlite":
+		return sqliteDialect{}, nil
+	default:
+		return nil, errors.New("unknown DB_DRIVER " + os.Getenv("DB_DRIVER") + ", use mysql, postgres or sqlite")
+	}
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string       { return "mysql" }
+func (mysqlDialect) DriverName() string { return "mysql" }
+
+func (mysqlDialect) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", os.Getenv("DB_USER"), os.Getenv("DB_PASS"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"))
+}
+
+func (mysqlDialect) Configure(_ *sql.DB) {}
+
+func (mysqlDialect) Rebind(query string) string {
+	return query
+}
+
+func (mysqlDialect) TableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var count int
+
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, table).Scan(&count)
+
+	return count > 0, err
+}
+
+// Lock uses GET_LOCK, it belongs to the connection and is released when it closes
+func (mysqlDialect) Lock(ctx context.Context, conn *sql.Conn, timeout time.Duration) error {
+	var locked sql.NullInt64
+
+	err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, migrationLock, int(timeout.Seconds())).Scan(&locked)
+	if err != nil {
+		return err
+	}
+
+	if !locked.Valid || locked.Int64 != 1 {
+		return errors.New("lock not granted within " + timeout.String())
+	}
+
+	return nil
+}
+
+func (mysqlDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT RELEASE_LOCK(?)`, migrationLock)
+	return err
+}
+
+func (mysqlDialect) TransactionalDDL() bool {
+	return false
+}
+
+// mysqlDuplicateEntry is ER_DUP_ENTRY
+const mysqlDuplicateEntry = 1062
+
+func (mysqlDialect) IsUniqueViolation(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+func (mysqlDialect) InsertIgnore(query string) string {
+	return strings.Replace(query, "INSERT INTO", "INSERT IGNORE INTO", 1)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string       { return "postgres" }
+func (postgresDialect) DriverName() string { return "postgres" }
+
+// DSN defaults to sslmode=disable like the mysql connection, DB_SSLMODE enables it
+func (postgresDialect) DSN() string {
+	sslMode := os.Getenv("DB_SSLMODE")
+
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(os.Getenv("DB_USER"), os.Getenv("DB_PASS")),
+		Host:     os.Getenv("DB_HOST") + ":" + os.Getenv("DB_PORT"),
+		Path:     "/" + os.Getenv("DB_NAME"),
+		RawQuery: "sslmode=" + url.QueryEscape(sslMode),
+	}
+
+	return dsn.String()
+}
+
+func (postgresDialect) Configure(_ *sql.DB) {}
+
+// Rebind numbers the placeholders, postgres doesn't understand ?. Question marks in string literals are kept
+func (postgresDialect) Rebind(query string) string {
+	var rebound strings.Builder
+	n := 0
+	inLiteral := false
+
+	for _, char := range query {
+		if char == '\'' {
+			inLiteral = !inLiteral
+		}
+
+		if char != '?' || inLiteral {
+			rebound.WriteRune(char)
+			continue
+		}
+
+		n++
+		rebound.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return rebound.String()
+}
+
+func (postgresDialect) TableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var count int
+
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1`, table).Scan(&count)
+
+	return count > 0, err
+}
+
+// postgresMigrationLock is the key of the advisory lock, any number other features don't use
+const postgresMigrationLock = 7411390214
+
+// Lock tries the advisory lock until the timeout, it belongs to the session like GET_LOCK
+func (postgresDialect) Lock(ctx context.Context, conn *sql.Conn, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		var locked bool
+
+		err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, postgresMigrationLock).Scan(&locked)
+		if err != nil {
+			return err
+		}
+
+		if locked {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("lock not granted within " + timeout.String())
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+func (postgresDialect) Unlock(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, postgresMigrationLock)
+	return err
+}
+
+func (postgresDialect) TransactionalDDL() bool {
+	return true
+}
+
+// postgresUniqueViolation is the SQLSTATE unique_violation
+const postgresUniqueViolation = "23505"
+
+func (postgresDialect) IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == postgresUniqueViolation
+}
+
+func (postgresDialect) InsertIgnore(query string) string {
+	return query + " ON CONFLICT DO NOTHING"
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string       { return "sqlite" }
+func (sqliteDialect) DriverName() string { return "sqlite3" }
+
+// DSN uses DB_NAME as path of the database file, it is created if it doesn't exist
+func (sqliteDialect) DSN() string {
+	return "file:" + os.Getenv("DB_NAME") + "?_busy_timeout=5000"
+}
+
+// Configure keeps a single connection, sqlite locks the whole file for writes anyway
+func (sqliteDialect) Configure(pool *sql.DB) {
+	pool.SetMaxOpenConns(1)
+}
+
+func (sqliteDialect) Rebind(query string) string {
+	return query
+}
+
+func (sqliteDialect) TableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	var count int
+
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&count)
+
+	return count > 0, err
+}
+
+// Lock isn't needed, there is only one connection and a sqlite file is not shared by replicas
+func (sqliteDialect) Lock(_ context.Context, _ *sql.Conn, _ time.Duration) error {
+	return nil
+}
+
+func (sqliteDialect) Unlock(_ context.Context, _ *sql.Conn) error {
+	return nil
+}
+
+func (sqliteDialect) TransactionalDDL() bool {
+	return true
+}
+
+func (sqliteDialect) IsUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+func (sqliteDialect) InsertIgnore(query string) string {
+	return strings.Replace(query, "INSERT INTO", "INSERT OR IGNORE INTO", 1)
+}
+
+/*
+database wraps the connection pool and rewrites the placeholders of every query for the dialect.
+Only the methods the package uses are wrapped, so no query can skip the rewrite or the context
+*/
+type database struct {
+	pool    *sql.DB
+	dialect dialect
+	// timeout limits every operation of the package, the context of the request can end it earlier
+	timeout time.Duration
+}
+
+// withTimeout derives the context of one operation, the caller has to cancel it when the operation is done
+func (d *database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d.timeout)
+}
+
+func (d *database) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := d.pool.ExecContext(ctx, d.dialect.Rebind(query), args...)
+	return result, contextError(ctx, err)
+}
+
+func (d *database) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := d.pool.QueryContext(ctx, d.dialect.Rebind(query), args...)
+	return rows, contextError(ctx, err)
+}
+
+func (d *database) QueryRowContext(ctx context.Context, query string, args ...any) *row {
+	return &row{row: d.pool.QueryRowContext(ctx, d.dialect.Rebind(query), args...), ctx: ctx}
+}
+
+func (d *database) BeginTx(ctx context.Context) (*transaction, error) {
+	tx, err := d.pool.BeginTx(ctx, nil)
+
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+
+	return &transaction{tx: tx, dialect: d.dialect}, nil
+}
+
+func (d *database) Conn(ctx context.Context) (*connection, error) {
+	conn, err := d.pool.Conn(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &connection{conn: conn, dialect: d.dialect}, nil
+}
+
+// row reports the end of the context like the other methods, the error of sql.Row only shows up in Scan
+type row struct {
+	row *sql.Row
+	ctx context.Context
+}
+
+func (r *row) Scan(dest ...any) error {
+	return contextError(r.ctx, r.row.Scan(dest...))
+}
+
+/*
+contextError replaces the error of a query which failed because its context ended with the error of the context.
+Drivers describe a cancelled query differently, callers check for context.DeadlineExceeded and context.Canceled
+*/
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		return fmt.Errorf("%w (%s)", ctx.Err(), err.Error())
+	}
+
+	return err
+}
+
+type transaction struct {
+	tx      *sql.Tx
+	dialect dialect
+}
+
+func (t *transaction) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := t.tx.ExecContext(ctx, t.dialect.Rebind(query), args...)
+	return result, contextError(ctx, err)
+}
+
+func (t *transaction) QueryRowContext(ctx context.Context, query string, args ...any) *row {
+	return &row{row: t.tx.QueryRowContext(ctx, t.dialect.Rebind(query), args...), ctx: ctx}
+}
+
+func (t *transaction) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *transaction) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// connection is a single connection of the pool, the migrations run on it while it holds the lock
+type connection struct {
+	conn    *sql.Conn
+	dialect dialect
+}
+
+func (c *connection) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return c.conn.ExecContext(ctx, c.dialect.Rebind(query), args...)
+}
+
+func (c *connection) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return c.conn.QueryContext(ctx, c.dialect.Rebind(query), args...)
+}
+
+func (c *connection) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return c.conn.QueryRowContext(ctx, c.dialect.Rebind(query), args...)
+}
+
+func (c *connection) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestPostgresRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "no placeholders", query: `SELECT COUNT(*) FROM users`, want: `SELECT COUNT(*) FROM users`},
+		{name: "one placeholder", query: `SELECT Email FROM users WHERE UserID = ?`, want: `SELECT Email FROM users WHERE UserID = $1`},
+		{
+			name:  "placeholders are numbered in order",
+			query: `INSERT INTO sessions (SessionID, PersonID, PersonType) VALUES (?, ?, ?)`,
+			want:  `INSERT INTO sessions (SessionID, PersonID, PersonType) VALUES ($1, $2, $3)`,
+		},
+		{name: "more than nine placeholders", query: `VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, want: `VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`},
+		{name: "question mark in a literal", query: `UPDATE users SET FirstName = 'who?' WHERE UserID = ?`, want: `UPDATE users SET FirstName = 'who?' WHERE UserID = $1`},
+		{name: "escaped quote in a literal", query: `SELECT 'it''s ?', ? FROM users`, want: `SELECT 'it''s ?', $1 FROM users`},
+		{name: "non ascii characters", query: `SELECT 'äöü', ?`, want: `SELECT 'äöü', $1`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := postgresDialect{}.Rebind(test.query)
+
+			if got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestInsertIgnore(t *testing.T) {
+	query := `INSERT INTO login_attempts (AttemptKey, AttemptCount) VALUES (?, 0)`
+
+	tests := []struct {
+		dialect dialect
+		want    string
+	}{
+		{dialect: mysqlDialect{}, want: `INSERT IGNORE INTO login_attempts (AttemptKey, AttemptCount) VALUES (?, 0)`},
+		{dialect: postgresDialect{}, want: `INSERT INTO login_attempts (AttemptKey, AttemptCount) VALUES (?, 0) ON CONFLICT DO NOTHING`},
+		{dialect: sqliteDialect{}, want: `INSERT OR IGNORE INTO login_attempts (AttemptKey, AttemptCount) VALUES (?, 0)`},
+	}
+
+	for _, test := range tests {
+		got := test.dialect.InsertIgnore(query)
+
+		if got != test.want {
+			t.Errorf("%s: got %s, want %s", test.dialect.Name(), got, test.want)
+		}
+	}
+}
+
+func TestDialectFromEnv(t *testing.T) {
+	tests := []struct {
+		driver string
+		name   string
+		fails  bool
+	}{
+		{driver: "", name: "mysql"},
+		{driver: "mysql", name: "mysql"},
+		{driver: "postgres", name: "postgres"},
+		{driver: "sqlite", name: "sqlite"},
+		{driver: "oracle", fails: true},
+	}
+
+	for _, test := range tests {
+		t.Setenv("DB_DRIVER", test.driver)
+
+		dialect, err := dialectFromEnv()
+
+		if test.fails {
+			if err == nil {
+				t.Errorf("DB_DRIVER %q: got %s, want an error", test.driver, dialect.Name())
+			}
+			continue
+		}
+
+		if err != nil || dialect.Name() != test.name {
+			t.Errorf("DB_DRIVER %q: got %v %v, want %s", test.driver, dialect, err, test.name)
+		}
+	}
+}
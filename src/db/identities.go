@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// IdentityStore keeps the links of identity provider subjects to admins
+type IdentityStore struct{}
+
+func NewIdentityStore() *IdentityStore {
+	return &IdentityStore{}
+}
+
+// GetAdminID returns the admin linked to the subject of the issuer, or an empty ID
+func (s *IdentityStore) GetAdminID(ctx context.Context, issuer, subject string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var adminID string
+
+	err := db.QueryRowContext(ctx, `SELECT AdminID FROM admin_identities WHERE Issuer = ? AND Subject = ?`, issuer, subject).Scan(&adminID)
+
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error occured getting admin identity from db %w", err)
+	}
+
+	return adminID, nil
+}
+
+func (s *IdentityStore) Link(ctx context.Context, issuer, subject, adminID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO admin_identities (Issuer, Subject, AdminID, Created) VALUES (?, ?, ?, ?)`, issuer, subject, adminID, time.Now().Unix())
+
+	if err != nil {
+		return fmt.Errorf("couldn't link admin identity: %w", err)
+	}
+
+	return nil
+}
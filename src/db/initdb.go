@@ -1,71 +1,115 @@
 package db
 
 import (
-	"fmt"
+	"backend/src/store"
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
 	"log"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
-// initDB creates the required tables if they don't exist
-func initDB() {
-	fmt.Println("Server: Creating tables...")
+/*
+seedRoles inserts missing default roles, on the first run every existing admin becomes superadmin.
+Permissions added in a later version are granted to the existing default roles which have them by default
+*/
+func seedRoles(conn *connection) {
+	ctx := context.Background()
+	added := map[string]bool{}
 
-	// Test table
-	testTableQuery := `CREATE TABLE IF NOT EXISTS test (
-		id INT AUTO_INCREMENT PRIMARY KEY,
-		name VARCHAR(255) NOT NULL
-	)`
+	for name, description := range store.DefaultPermissions {
+		var existing string
 
-	_, err := db.Exec(testTableQuery)
-	if err != nil {
-		log.Fatal("Server: Error creating test table: ", err.Error())
+		err := conn.QueryRowContext(ctx, `SELECT Name FROM permissions WHERE Name = ?`, name).Scan(&existing)
+
+		if err == nil {
+			continue
+		}
+
+		if err != sql.ErrNoRows {
+			log.Fatal("Server: Error checking permissions: ", err.Error())
+		}
+
+		_, err = conn.ExecContext(ctx, `INSERT INTO permissions (Name, Description) VALUES (?, ?)`, name, description)
+		if err != nil {
+			log.Fatal("Server: Error inserting permission: ", err.Error())
+		}
+
+		added[name] = true
 	}
 
-	insertTestRowQuery := `INSERT INTO test (id, name) VALUES (1, 'test')`
-	_, err = db.Exec(insertTestRowQuery)
-	if err != nil {
-		log.Fatal("Server: Error inserting first row into test table: ", err.Error())
+	for _, role := range store.DefaultRoles {
+		var name string
+
+		err := conn.QueryRowContext(ctx, `SELECT Name FROM roles WHERE Name = ?`, role.Name).Scan(&name)
+
+		if err == nil {
+			for _, permission := range role.Permissions {
+				if !added[permission] {
+					continue
+				}
+
+				_, err = conn.ExecContext(ctx, `INSERT INTO role_permissions (RoleName, PermissionName) VALUES (?, ?)`, role.Name, permission)
+				if err != nil {
+					log.Fatal("Server: Error inserting role permission: ", err.Error())
+				}
+			}
+
+			continue
+		}
+
+		if err != sql.ErrNoRows {
+			log.Fatal("Server: Error checking roles: ", err.Error())
+		}
+
+		_, err = conn.ExecContext(ctx, `INSERT INTO roles (Name, Description) VALUES (?, ?)`, role.Name, role.Description)
+		if err != nil {
+			log.Fatal("Server: Error inserting role: ", err.Error())
+		}
+
+		for _, permission := range role.Permissions {
+			_, err = conn.ExecContext(ctx, `INSERT INTO role_permissions (RoleName, PermissionName) VALUES (?, ?)`, role.Name, permission)
+			if err != nil {
+				log.Fatal("Server: Error inserting role permission: ", err.Error())
+			}
+		}
 	}
 
-	// Create admins table
-	adminsTableQuery := `CREATE TABLE IF NOT EXISTS admins (
-		AdminID varchar(36) NOT NULL PRIMARY KEY,
-		Email text NOT NULL,
-		UserName text NOT NULL,
-		Password text NOT NULL,
-		Created int NOT NULL
-	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;`
+	var assigned int
 
-	_, err = db.Exec(adminsTableQuery)
+	err := conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_roles`).Scan(&assigned)
 	if err != nil {
-		log.Fatal("Server: Error creating admins table: ", err.Error())
+		log.Fatal("Server: Error counting admin roles: ", err.Error())
 	}
 
-	// Insert initial rows into the admins table
-	insertAdminsQuery := `INSERT INTO admins (AdminID, Email, UserName, Password, Created) VALUES
-	('99278b45-63d3-11ef-9353-0242c0a8b502', 'julian.boehne@web.de', 'Julian', '$2a$12$vQmM9YShnUlX9ZZFRXwNOuRkbNmi8dSMjHfx0wKekXJZeoeGT4dvO', 1724694578),
-	('d23d9df9-63d3-11ef-9353-0242c0a8b502', 'wolf_david@gmx.de', 'David', '$2a$12$foK/kJYQn6QjlOTFXIw9FODo2motgflWuM2xTA0agV/HqiVQ2inCu', 1724694649);`
+	if assigned > 0 {
+		return
+	}
 
-	_, err = db.Exec(insertAdminsQuery)
+	// the ids are read first, the connection can't insert while the rows are open
+	rows, err := conn.QueryContext(ctx, `SELECT AdminID FROM admins`)
 	if err != nil {
-		log.Fatal("Server: Error inserting initial rows into admins table: ", err.Error())
+		log.Fatal("Server: Error reading admins: ", err.Error())
 	}
 
-	// Create users table with UserID as PRIMARY KEY and UNIQUE
-	usersTableQuery := `CREATE TABLE IF NOT EXISTS users (
-		UserID varchar(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL PRIMARY KEY,
-		FirstName text NOT NULL,
-		LastName text NOT NULL,
-		Email text NOT NULL,
-		Password text NOT NULL,
-		Created int NOT NULL
-	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;`
-
-	_, err = db.Exec(usersTableQuery)
-	if err != nil {
-		log.Fatal("Server: Error creating users table: ", err.Error())
+	var adminIDs []string
+
+	for rows.Next() {
+		var adminID string
+
+		err = rows.Scan(&adminID)
+		if err != nil {
+			log.Fatal("Server: Error reading admins: ", err.Error())
+		}
+
+		adminIDs = append(adminIDs, adminID)
 	}
 
-	fmt.Println("Server: Tables created and initial data inserted successfully")
+	rows.Close()
+
+	for _, adminID := range adminIDs {
+		_, err = conn.ExecContext(ctx, `INSERT INTO admin_roles (AdminID, RoleName) VALUES (?, ?)`, adminID, customTypes.RoleSuperadmin)
+		if err != nil {
+			log.Fatal("Server: Error assigning superadmin role: ", err.Error())
+		}
+	}
 }
@@ -0,0 +1,70 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MagicLinkStore keeps the login links of users
+type MagicLinkStore struct{}
+
+func NewMagicLinkStore() *MagicLinkStore {
+	return &MagicLinkStore{}
+}
+
+func (s *MagicLinkStore) Save(ctx context.Context, link *customTypes.MagicLink) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO magic_links (TokenID, UserID, Email, ExpiresAt, Used, Created) VALUES (?, ?, ?, ?, ?, ?)`, link.TokenID, link.UserID, link.Email, link.ExpiresAt, false, link.Created)
+
+	if err != nil {
+		return fmt.Errorf("couldn't store magic link: %w", err)
+	}
+
+	return nil
+}
+
+/*
+Consume marks the link as used and returns it.
+It fails if the link doesn't exist, expired or was used before
+*/
+func (s *MagicLinkStore) Consume(ctx context.Context, tokenID string) (*customTypes.MagicLink, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE magic_links SET Used = ? WHERE TokenID = ? AND Used = ? AND ExpiresAt >= ?`, true, tokenID, false, time.Now().Unix())
+
+	if err != nil {
+		return nil, fmt.Errorf("error while updating db %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, fmt.Errorf("error while checking affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, errors.New("invalid or used login link")
+	}
+
+	var link customTypes.MagicLink
+
+	err = db.QueryRowContext(ctx, `SELECT TokenID, UserID, Email, ExpiresAt, Used, Created FROM magic_links WHERE TokenID = ?`, tokenID).Scan(&link.TokenID, &link.UserID, &link.Email, &link.ExpiresAt, &link.Used, &link.Created)
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting magic link from db %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, `DELETE FROM magic_links WHERE ExpiresAt < ?`, time.Now().Unix())
+
+	if err != nil {
+		return nil, fmt.Errorf("error while deleting expired magic links %w", err)
+	}
+
+	return &link, nil
+}
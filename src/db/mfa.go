@@ -0,0 +1,236 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MFAStore keeps the totp secrets and recovery codes of admins
+type MFAStore struct{}
+
+func NewMFAStore() *MFAStore {
+	return &MFAStore{}
+}
+
+// SettingStore keeps runtime settings in the settings table
+type SettingStore struct{}
+
+func NewSettingStore() *SettingStore {
+	return &SettingStore{}
+}
+
+// Get returns the totp enrollment of an admin or nil if the admin never started one
+func (s *MFAStore) Get(ctx context.Context, adminID string) (*customTypes.AdminMFA, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var mfa customTypes.AdminMFA
+
+	err := db.QueryRowContext(ctx, `SELECT AdminID, Secret, Enabled, LastUsedStep, Created FROM admin_mfa WHERE AdminID = ?`, adminID).Scan(&mfa.AdminID, &mfa.Secret, &mfa.Enabled, &mfa.LastUsedStep, &mfa.Created)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting mfa from db %w", err)
+	}
+
+	return &mfa, nil
+}
+
+// SavePending starts a new enrollment, it replaces an enrollment which was never confirmed
+func (s *MFAStore) SavePending(ctx context.Context, adminID, secret string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx)
+
+	if err != nil {
+		return fmt.Errorf("couldn't start transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM admin_mfa WHERE AdminID = ? AND Enabled = ?`, adminID, false)
+
+	if err != nil {
+		return fmt.Errorf("error while removing pending mfa %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO admin_mfa (AdminID, Secret, Enabled, LastUsedStep, Created) VALUES (?, ?, ?, ?, ?)`, adminID, secret, false, 0, time.Now().Unix())
+
+	if err != nil {
+		return fmt.Errorf("couldn't store mfa secret: %w", err)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("couldn't commit mfa secret: %w", err)
+	}
+
+	return nil
+}
+
+// Enable finishes the enrollment and replaces all recovery codes with the new ones
+func (s *MFAStore) Enable(ctx context.Context, adminID string, step int64, recoveryCodeHashes []string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx)
+
+	if err != nil {
+		return fmt.Errorf("couldn't start transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE admin_mfa SET Enabled = ?, LastUsedStep = ? WHERE AdminID = ?`, true, step, adminID)
+
+	if err != nil {
+		return fmt.Errorf("error while enabling mfa %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM admin_recovery_codes WHERE AdminID = ?`, adminID)
+
+	if err != nil {
+		return fmt.Errorf("error while removing recovery codes %w", err)
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO admin_recovery_codes (CodeHash, AdminID, Used) VALUES (?, ?, ?)`, hash, adminID, false)
+
+		if err != nil {
+			return fmt.Errorf("couldn't store recovery code: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("couldn't commit mfa: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MFAStore) Disable(ctx context.Context, adminID string) error {
+	return disableMFA(ctx, adminID)
+}
+
+// disableMFA is shared with the admin store, which removes the mfa of deleted admins
+func disableMFA(ctx context.Context, adminID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM admin_mfa WHERE AdminID = ?`, adminID)
+
+	if err != nil {
+		return fmt.Errorf("error while disabling mfa %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, `DELETE FROM admin_recovery_codes WHERE AdminID = ?`, adminID)
+
+	if err != nil {
+		return fmt.Errorf("error while removing recovery codes %w", err)
+	}
+
+	return nil
+}
+
+// UseStep stores the time step of a valid code, false means the step was used concurrently
+func (s *MFAStore) UseStep(ctx context.Context, adminID string, step int64) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE admin_mfa SET LastUsedStep = ? WHERE AdminID = ? AND LastUsedStep < ?`, step, adminID, step)
+
+	if err != nil {
+		return false, fmt.Errorf("error while updating db %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, fmt.Errorf("error while checking affected rows: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// UseRecoveryCode marks the code as used, false is returned if it doesn't exist or was used before
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, adminID, codeHash string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE admin_recovery_codes SET Used = ? WHERE CodeHash = ? AND AdminID = ? AND Used = ?`, true, codeHash, adminID, false)
+
+	if err != nil {
+		return false, fmt.Errorf("error while updating db %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, fmt.Errorf("error while checking affected rows: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// Get returns the value of a setting or the fallback if it was never set
+func (s *SettingStore) Get(ctx context.Context, name, fallback string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var value string
+
+	err := db.QueryRowContext(ctx, `SELECT Value FROM settings WHERE Name = ?`, name).Scan(&value)
+
+	if err == sql.ErrNoRows {
+		return fallback, nil
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error occured getting setting from db %w", err)
+	}
+
+	return value, nil
+}
+
+func (s *SettingStore) Set(ctx context.Context, name, value string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx)
+
+	if err != nil {
+		return fmt.Errorf("couldn't start transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM settings WHERE Name = ?`, name)
+
+	if err != nil {
+		return fmt.Errorf("error while updating setting %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO settings (Name, Value) VALUES (?, ?)`, name, value)
+
+	if err != nil {
+		return fmt.Errorf("error while updating setting %w", err)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("couldn't commit setting: %w", err)
+	}
+
+	return nil
+}
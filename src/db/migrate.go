@@ -0,0 +1,426 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+every dialect has its own migrations in migrations/<dialect>, named <version>_<name>.up.sql and <version>_<name>.down.sql.
+Versions mean the same change in all dialects.
+Statements end with a semicolon at the end of a line, lines starting with -- are comments
+*/
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var statementEnd = regexp.MustCompile(`;\s*\n`)
+
+// migrationLock is held while migrating so replicas starting at the same time wait for each other
+const migrationLock = "schema_migrations"
+
+const defaultMigrationLockTimeout = time.Minute
+
+// loadMigrations reads the embedded scripts of the dialect ordered by version, every version needs an up and a down script
+func loadMigrations() ([]customTypes.Migration, error) {
+	dir := "migrations/" + db.dialect.Name()
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+
+	if err != nil {
+		return nil, errors.New("couldn't read migrations: " + err.Error())
+	}
+
+	byVersion := map[int]*customTypes.Migration{}
+
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+
+		if match == nil {
+			return nil, errors.New("invalid migration file name " + entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := migrationFiles.ReadFile(dir + "/" + entry.Name())
+		if err != nil {
+			return nil, errors.New("couldn't read migration " + entry.Name() + ": " + err.Error())
+		}
+
+		migration, ok := byVersion[version]
+
+		if !ok {
+			migration = &customTypes.Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+			sum := sha256.Sum256(content)
+			migration.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := []customTypes.Migration{}
+
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs an up and a down script", migration.Version)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+/*
+MigrateUp applies all pending migrations in order and seeds the default roles afterwards.
+It fails without changes if an applied migration was edited after it ran
+*/
+func MigrateUp() ([]customTypes.Migration, error) {
+	migrations, err := loadMigrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []customTypes.Migration{}
+
+	err = withMigrationLock(func(conn *connection) error {
+		done, err := appliedMigrations(conn)
+
+		if err != nil {
+			return err
+		}
+
+		err = verifyChecksums(migrations, done)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			fmt.Printf("Server: Applying migration %d_%s\n", migration.Version, migration.Name)
+
+			err = runMigration(conn, migration.Up, `INSERT INTO schema_migrations (Version, Name, Checksum, AppliedAt) VALUES (?, ?, ?, ?)`, migration.Version, migration.Name, migration.Checksum, time.Now().Unix())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %s", migration.Version, migration.Name, err.Error())
+			}
+
+			applied = append(applied, migration)
+		}
+
+		seedRoles(conn)
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first
+func MigrateDown(steps int) ([]customTypes.Migration, error) {
+	migrations, err := loadMigrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := []customTypes.Migration{}
+
+	err = withMigrationLock(func(conn *connection) error {
+		done, err := appliedMigrations(conn)
+
+		if err != nil {
+			return err
+		}
+
+		err = verifyChecksums(migrations, done)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+
+			if _, ok := done[migration.Version]; !ok {
+				continue
+			}
+
+			fmt.Printf("Server: Reverting migration %d_%s\n", migration.Version, migration.Name)
+
+			err = runMigration(conn, migration.Down, `DELETE FROM schema_migrations WHERE Version = ?`, migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %s", migration.Version, migration.Name, err.Error())
+			}
+
+			reverted = append(reverted, migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// MigrationStatuses lists every known migration and if it was applied
+func MigrationStatuses() ([]customTypes.MigrationStatus, error) {
+	migrations, err := loadMigrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, errors.New("couldn't get database connection: " + err.Error())
+	}
+
+	defer conn.Close()
+
+	done, err := appliedMigrations(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []customTypes.MigrationStatus{}
+
+	for _, migration := range migrations {
+		status := customTypes.MigrationStatus{Migration: migration}
+
+		if record, ok := done[migration.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// PendingMigrations counts the migrations which weren't applied yet
+func PendingMigrations() (int, error) {
+	statuses, err := MigrationStatuses()
+
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+
+	for _, status := range statuses {
+		if !status.Applied {
+			pending++
+		}
+	}
+
+	return pending, nil
+}
+
+/*
+withMigrationLock runs fn on a single connection which holds the migration lock.
+The lock belongs to the connection, the scripts use session variables too, so everything has to run on it
+*/
+func withMigrationLock(fn func(conn *connection) error) error {
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return errors.New("couldn't get database connection: " + err.Error())
+	}
+
+	defer conn.Close()
+
+	timeout := utils.GetEnvDuration("MIGRATION_LOCK_TIMEOUT", defaultMigrationLockTimeout)
+
+	err = db.dialect.Lock(ctx, conn.conn, timeout)
+	if err != nil {
+		return errors.New("couldn't acquire migration lock, another instance may be migrating: " + err.Error())
+	}
+
+	defer func() {
+		err := db.dialect.Unlock(ctx, conn.conn)
+		if err != nil {
+			fmt.Println("Server: Error releasing migration lock: ", err.Error())
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		Version bigint NOT NULL PRIMARY KEY,
+		Name varchar(255) NOT NULL,
+		Checksum char(64) NOT NULL,
+		AppliedAt bigint NOT NULL
+	)`)
+	if err != nil {
+		return errors.New("couldn't create schema_migrations table: " + err.Error())
+	}
+
+	return fn(conn)
+}
+
+type appliedMigration struct {
+	Checksum  string
+	AppliedAt int64
+}
+
+// appliedMigrations returns the recorded migrations by version, a database without the table has none
+func appliedMigrations(conn *connection) (map[int]appliedMigration, error) {
+	ctx := context.Background()
+	done := map[int]appliedMigration{}
+
+	exists, err := db.dialect.TableExists(ctx, conn.conn, "schema_migrations")
+	if err != nil {
+		return nil, errors.New("couldn't check schema_migrations table: " + err.Error())
+	}
+
+	if !exists {
+		return done, nil
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT Version, Checksum, AppliedAt FROM schema_migrations`)
+	if err != nil {
+		return nil, errors.New("couldn't read applied migrations: " + err.Error())
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var record appliedMigration
+
+		err = rows.Scan(&version, &record.Checksum, &record.AppliedAt)
+		if err != nil {
+			return nil, errors.New("couldn't read applied migrations: " + err.Error())
+		}
+
+		done[version] = record
+	}
+
+	return done, rows.Err()
+}
+
+// verifyChecksums refuses to continue if an applied script changed, unknown versions come from a newer release and are only logged
+func verifyChecksums(migrations []customTypes.Migration, done map[int]appliedMigration) error {
+	known := map[int]bool{}
+
+	for _, migration := range migrations {
+		known[migration.Version] = true
+
+		record, ok := done[migration.Version]
+
+		if ok && record.Checksum != migration.Checksum {
+			return fmt.Errorf("migration %d_%s was changed after it was applied, add a new migration instead", migration.Version, migration.Name)
+		}
+	}
+
+	for version := range done {
+		if !known[version] {
+			fmt.Printf("Server: Database has migration %d which this version doesn't know\n", version)
+		}
+	}
+
+	return nil
+}
+
+/*
+runMigration executes the script and records it with the query.
+Both run in one transaction if the dialect can roll back schema changes, mysql commits them immediately
+*/
+func runMigration(conn *connection, script string, record string, args ...any) error {
+	ctx := context.Background()
+
+	if !db.dialect.TransactionalDDL() {
+		err := execScript(ctx, conn.conn, script)
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.ExecContext(ctx, record, args...)
+		if err != nil {
+			return errors.New("couldn't record migration: " + err.Error())
+		}
+
+		return nil
+	}
+
+	tx, err := conn.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.New("couldn't start transaction: " + err.Error())
+	}
+
+	defer tx.Rollback()
+
+	err = execScript(ctx, tx, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, db.dialect.Rebind(record), args...)
+	if err != nil {
+		return errors.New("couldn't record migration: " + err.Error())
+	}
+
+	return tx.Commit()
+}
+
+// scriptExecer is a connection or a transaction
+type scriptExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// execScript runs the statements of a script one by one, they are passed to the driver as written
+func execScript(ctx context.Context, execer scriptExecer, script string) error {
+	lines := []string{}
+
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	for _, statement := range statementEnd.Split(strings.Join(lines, "\n")+"\n", -1) {
+		statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+
+		if statement == "" {
+			continue
+		}
+
+		_, err := execer.ExecContext(ctx, statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
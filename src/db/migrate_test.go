@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openSQLite opens a new sqlite database in a temporary directory, the migrations aren't applied yet
+func openSQLite(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_NAME", filepath.Join(t.TempDir(), "test.db"))
+
+	Open()
+
+	t.Cleanup(func() { db.pool.Close() })
+}
+
+func migrateUp(t *testing.T) {
+	t.Helper()
+
+	_, err := MigrateUp()
+	if err != nil {
+		t.Fatalf("migrating up: %v", err)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	openSQLite(t)
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up := func() (int, error) {
+		applied, err := MigrateUp()
+		return len(applied), err
+	}
+
+	down := func(steps int) func() (int, error) {
+		return func() (int, error) {
+			reverted, err := MigrateDown(steps)
+			return len(reverted), err
+		}
+	}
+
+	steps := []struct {
+		name     string
+		run      func() (int, error)
+		affected int
+		pending  int
+	}{
+		{name: "up on a new database", run: up, affected: len(migrations), pending: 0},
+		{name: "up again", run: up, affected: 0, pending: 0},
+		{name: "down one", run: down(1), affected: 1, pending: 1},
+		{name: "up after down", run: up, affected: 1, pending: 0},
+		{name: "down everything", run: down(len(migrations) + 1), affected: len(migrations), pending: len(migrations)},
+		{name: "up from scratch", run: up, affected: len(migrations), pending: 0},
+	}
+
+	for _, step := range steps {
+		affected, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if affected != step.affected {
+			t.Errorf("%s: %d migrations ran, want %d", step.name, affected, step.affected)
+		}
+
+		pending, err := PendingMigrations()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if pending != step.pending {
+			t.Errorf("%s: %d migrations pending, want %d", step.name, pending, step.pending)
+		}
+	}
+
+	statuses, err := MigrationStatuses()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, status := range statuses {
+		if !status.Applied {
+			t.Errorf("migration %d_%s isn't applied", status.Version, status.Name)
+		}
+	}
+
+	// the default roles are seeded after migrating
+	roles, err := NewRoleStore().List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*roles) != 3 {
+		t.Errorf("got %d roles, want the 3 default roles", len(*roles))
+	}
+}
+
+func TestMigrateUpRefusesChangedMigrations(t *testing.T) {
+	openSQLite(t)
+	migrateUp(t)
+
+	_, err := db.ExecContext(context.Background(), `UPDATE schema_migrations SET Checksum = ? WHERE Version = ?`, "changed", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = MigrateUp()
+
+	if err == nil || !strings.Contains(err.Error(), "was changed after it was applied") {
+		t.Errorf("got %v, want the changed migration to be refused", err)
+	}
+}
+
+func TestUniqueEmailMigration(t *testing.T) {
+	tests := []struct {
+		name   string
+		users  []string
+		admins []string
+		// the error of the migration, empty if it succeeds
+		err    string
+		emails []string
+	}{
+		{name: "distinct emails are normalized", users: []string{" Ada@Example.com", "grace@example.com"}, emails: []string{"ada@example.com", "grace@example.com"}},
+		{name: "user emails differing in case", users: []string{"ada@example.com", "ADA@example.com"}, err: "resolve_duplicate_user_emails_first", emails: []string{"ADA@example.com", "ada@example.com"}},
+		{name: "user emails differing in spaces", users: []string{"ada@example.com", "ada@example.com "}, err: "resolve_duplicate_user_emails_first", emails: []string{"ada@example.com", "ada@example.com "}},
+		{name: "admin emails differing in case", users: []string{" Ada@Example.com"}, admins: []string{"JULIAN.BOEHNE@web.de"}, err: "resolve_duplicate_admin_emails_first", emails: []string{" Ada@Example.com"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			openSQLite(t)
+			migrateUp(t)
+
+			_, err := MigrateDown(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, email := range test.users {
+				_, err = db.ExecContext(ctx, `INSERT INTO users (UserID, FirstName, LastName, Email, Password, Created, EmailVerified) VALUES (?, ?, ?, ?, ?, ?, ?)`, strings.Repeat(string(rune('a'+i)), 36), "Ada", "Lovelace", email, "hash", 1, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for i, email := range test.admins {
+				_, err = db.ExecContext(ctx, `INSERT INTO admins (AdminID, Email, UserName, Password, Created) VALUES (?, ?, ?, ?, ?)`, strings.Repeat(string(rune('a'+i)), 36), email, "Julian", "hash", 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err = MigrateUp()
+
+			if test.err == "" && err != nil {
+				t.Fatalf("got %v, want the migration to succeed", err)
+			}
+
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("got %v, want an error naming %s", err, test.err)
+			}
+
+			// a failed migration must not change any email
+			rows, err := db.QueryContext(ctx, `SELECT Email FROM users ORDER BY Email`)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer rows.Close()
+
+			emails := []string{}
+
+			for rows.Next() {
+				var email string
+
+				err = rows.Scan(&email)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				emails = append(emails, email)
+			}
+
+			if strings.Join(emails, "|") != strings.Join(test.emails, "|") {
+				t.Errorf("got emails %q, want %q", emails, test.emails)
+			}
+		})
+	}
+}
+
+func TestUniqueEmailIndex(t *testing.T) {
+	openSQLite(t)
+	migrateUp(t)
+
+	ctx := context.Background()
+	insert := `INSERT INTO users (UserID, FirstName, LastName, Email, Password, Created, EmailVerified) VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := db.ExecContext(ctx, insert, strings.Repeat("a", 36), "Ada", "Lovelace", "ada@example.com", "hash", 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.ExecContext(ctx, insert, strings.Repeat("b", 36), "Ada", "Lovelace", "ADA@example.com", "hash", 1, false)
+
+	if !db.dialect.IsUniqueViolation(err) {
+		t.Errorf("got %v, want a unique violation", err)
+	}
+}
@@ -0,0 +1,204 @@
+-- schema of the versions before migrations existed, every statement is safe to run on such a database
+
+CREATE TABLE IF NOT EXISTS admins (
+	AdminID varchar(36) NOT NULL PRIMARY KEY,
+	Email text NOT NULL,
+	UserName text NOT NULL,
+	Password text NOT NULL,
+	Created int NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- the initial admins are only created in an empty database, deleted ones don't come back
+INSERT INTO admins (AdminID, Email, UserName, Password, Created)
+SELECT * FROM (
+	SELECT '99278b45-63d3-11ef-9353-0242c0a8b502', 'julian.boehne@web.de', 'Julian', '$2a$12$vQmM9YShnUlX9ZZFRXwNOuRkbNmi8dSMjHfx0wKekXJZeoeGT4dvO', 1724694578
+	UNION ALL
+	SELECT 'd23d9df9-63d3-11ef-9353-0242c0a8b502', 'wolf_david@gmx.de', 'David', '$2a$12$foK/kJYQn6QjlOTFXIw9FODo2motgflWuM2xTA0agV/HqiVQ2inCu', 1724694649
+) AS initial_admins
+WHERE NOT EXISTS (SELECT 1 FROM admins);
+
+CREATE TABLE IF NOT EXISTS users (
+	UserID varchar(36) CHARACTER SET utf8mb4 COLLATE utf8mb4_0900_ai_ci NOT NULL PRIMARY KEY,
+	FirstName text NOT NULL,
+	LastName text NOT NULL,
+	Email text NOT NULL,
+	Password text NOT NULL,
+	Created int NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- mysql has no ADD COLUMN IF NOT EXISTS, the statement is built from information_schema instead
+-- users registered before verification existed are treated as verified
+SET @statement = (SELECT IF(COUNT(*) = 0, 'ALTER TABLE users ADD COLUMN EmailVerified boolean NOT NULL DEFAULT TRUE', 'DO 0') FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'EmailVerified');
+PREPARE statement FROM @statement;
+EXECUTE statement;
+DEALLOCATE PREPARE statement;
+
+-- set by admins, the next login has to change the password before it gets tokens
+SET @statement = (SELECT IF(COUNT(*) = 0, 'ALTER TABLE users ADD COLUMN MustChangePassword boolean NOT NULL DEFAULT FALSE', 'DO 0') FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'MustChangePassword');
+PREPARE statement FROM @statement;
+EXECUTE statement;
+DEALLOCATE PREPARE statement;
+
+SET @statement = (SELECT IF(COUNT(*) = 0, 'ALTER TABLE admins ADD COLUMN MustChangePassword boolean NOT NULL DEFAULT FALSE', 'DO 0') FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'admins' AND COLUMN_NAME = 'MustChangePassword');
+PREPARE statement FROM @statement;
+EXECUTE statement;
+DEALLOCATE PREPARE statement;
+
+-- password, magic_link or both
+SET @statement = (SELECT IF(COUNT(*) = 0, 'ALTER TABLE users ADD COLUMN LoginMethods varchar(16) NOT NULL DEFAULT ''both''', 'DO 0') FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND COLUMN_NAME = 'LoginMethods');
+PREPARE statement FROM @statement;
+EXECUTE statement;
+DEALLOCATE PREPARE statement;
+
+-- refresh tokens are stored hashed, a family groups all tokens created by rotating one login
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	TokenHash varchar(64) NOT NULL PRIMARY KEY,
+	FamilyID varchar(36) NOT NULL,
+	PersonID varchar(36) NOT NULL,
+	PersonType int NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Created bigint NOT NULL,
+	Revoked boolean NOT NULL DEFAULT FALSE,
+	INDEX refresh_tokens_family (FamilyID)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- access tokens revoked before they expire, rows can be removed once ExpiresAt has passed
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	TokenID varchar(36) NOT NULL PRIMARY KEY,
+	ExpiresAt bigint NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS roles (
+	Name varchar(64) NOT NULL PRIMARY KEY,
+	Description text NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS permissions (
+	Name varchar(64) NOT NULL PRIMARY KEY,
+	Description text NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+	RoleName varchar(64) NOT NULL,
+	PermissionName varchar(64) NOT NULL,
+	PRIMARY KEY (RoleName, PermissionName)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS admin_roles (
+	AdminID varchar(36) NOT NULL,
+	RoleName varchar(64) NOT NULL,
+	PRIMARY KEY (AdminID, RoleName)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- totp secrets of admins, Enabled is false until the first code was confirmed
+CREATE TABLE IF NOT EXISTS admin_mfa (
+	AdminID varchar(36) NOT NULL PRIMARY KEY,
+	Secret varchar(64) NOT NULL,
+	Enabled boolean NOT NULL DEFAULT FALSE,
+	LastUsedStep bigint NOT NULL DEFAULT 0,
+	Created bigint NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS admin_recovery_codes (
+	CodeHash varchar(64) NOT NULL PRIMARY KEY,
+	AdminID varchar(36) NOT NULL,
+	Used boolean NOT NULL DEFAULT FALSE,
+	INDEX admin_recovery_codes_admin (AdminID)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- settings admins can change at runtime
+CREATE TABLE IF NOT EXISTS settings (
+	Name varchar(64) NOT NULL PRIMARY KEY,
+	Value text NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- password reset tokens are stored hashed and can only be used once
+CREATE TABLE IF NOT EXISTS password_resets (
+	TokenHash varchar(64) NOT NULL PRIMARY KEY,
+	PersonID varchar(36) NOT NULL,
+	PersonType int NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Used boolean NOT NULL DEFAULT FALSE,
+	Created bigint NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+	TokenHash varchar(64) NOT NULL PRIMARY KEY,
+	UserID varchar(36) NOT NULL,
+	Email varchar(255) NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Created bigint NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- failed logins for the database backed rate limiter, IpAttempts is a json object
+CREATE TABLE IF NOT EXISTS login_attempts (
+	AttemptKey varchar(255) NOT NULL PRIMARY KEY,
+	AttemptCount int NOT NULL,
+	LastAttempt bigint NOT NULL,
+	BlockedUntil bigint NOT NULL,
+	IpAttempts text NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- one row per login, the refresh token family and the jti of access tokens are the SessionID
+CREATE TABLE IF NOT EXISTS sessions (
+	SessionID varchar(36) NOT NULL PRIMARY KEY,
+	PersonID varchar(36) NOT NULL,
+	PersonType int NOT NULL,
+	UserAgent text NOT NULL,
+	IP varchar(45) NOT NULL,
+	Created bigint NOT NULL,
+	LastSeen bigint NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Revoked boolean NOT NULL DEFAULT FALSE,
+	INDEX sessions_person (PersonID, PersonType)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- keys are looked up by their prefix, only the sha256 of the whole key is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+	KeyID varchar(36) NOT NULL PRIMARY KEY,
+	Name varchar(255) NOT NULL,
+	Prefix varchar(16) NOT NULL UNIQUE,
+	KeyHash char(64) NOT NULL,
+	Scopes text NOT NULL,
+	CreatedBy varchar(36) NOT NULL,
+	Created bigint NOT NULL,
+	LastUsed bigint NOT NULL DEFAULT 0,
+	Revoked boolean NOT NULL DEFAULT FALSE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- links the subject of an identity provider to an admin
+CREATE TABLE IF NOT EXISTS admin_identities (
+	Issuer varchar(255) NOT NULL,
+	Subject varchar(255) NOT NULL,
+	AdminID varchar(36) NOT NULL,
+	Created bigint NOT NULL,
+	PRIMARY KEY (Issuer, Subject),
+	INDEX admin_identities_admin (AdminID)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- the links are signed tokens, the table makes sure every link logs in only once
+CREATE TABLE IF NOT EXISTS magic_links (
+	TokenID varchar(36) NOT NULL PRIMARY KEY,
+	UserID varchar(36) NOT NULL,
+	Email varchar(255) NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Used boolean NOT NULL DEFAULT FALSE,
+	Created bigint NOT NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	ID bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	ActorID varchar(36) NOT NULL,
+	ActorType int NOT NULL,
+	SubjectID varchar(36) NOT NULL,
+	SubjectType int NOT NULL,
+	Action text NOT NULL,
+	Status int NOT NULL,
+	IP varchar(45) NOT NULL,
+	Created bigint NOT NULL,
+	INDEX audit_log_actor (ActorID),
+	INDEX audit_log_subject (SubjectID)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- only used by the connection check of versions before migrations
+DROP TABLE IF EXISTS test;
@@ -0,0 +1,5 @@
+DROP INDEX admins_email ON admins;
+DROP INDEX users_email ON users;
+
+ALTER TABLE admins MODIFY Email text NOT NULL;
+ALTER TABLE users MODIFY Email text NOT NULL;
@@ -0,0 +1,33 @@
+-- existing duplicates abort the migration before anything is changed, see "Duplicate emails" in the README.
+-- mysql can't roll back the statements below, the named CHECK constraints make the error tell what to fix
+DROP TEMPORARY TABLE IF EXISTS email_duplicates;
+CREATE TEMPORARY TABLE email_duplicates (
+	Users int NOT NULL CONSTRAINT resolve_duplicate_user_emails_first CHECK (Users = 0),
+	Admins int NOT NULL CONSTRAINT resolve_duplicate_admin_emails_first CHECK (Admins = 0),
+	LongEmails int NOT NULL CONSTRAINT shorten_emails_over_255_characters_first CHECK (LongEmails = 0)
+);
+INSERT INTO email_duplicates (Users, Admins, LongEmails) SELECT
+	(SELECT COUNT(*) FROM (SELECT LOWER(TRIM(Email)) AS Email FROM users GROUP BY LOWER(TRIM(Email)) HAVING COUNT(*) > 1) AS duplicates),
+	(SELECT COUNT(*) FROM (SELECT LOWER(TRIM(Email)) AS Email FROM admins GROUP BY LOWER(TRIM(Email)) HAVING COUNT(*) > 1) AS duplicates),
+	(SELECT COUNT(*) FROM users WHERE CHAR_LENGTH(TRIM(Email)) > 255) + (SELECT COUNT(*) FROM admins WHERE CHAR_LENGTH(TRIM(Email)) > 255);
+DROP TEMPORARY TABLE email_duplicates;
+
+-- emails are stored trimmed and in lower case, existing addresses are normalized before the index is created
+UPDATE users SET Email = LOWER(TRIM(Email));
+UPDATE admins SET Email = LOWER(TRIM(Email));
+
+-- text columns can only be indexed with a prefix length
+ALTER TABLE users MODIFY Email varchar(255) NOT NULL;
+ALTER TABLE admins MODIFY Email varchar(255) NOT NULL;
+
+-- the collation of the tables ignores case, so the index is case-insensitive without LOWER
+-- mysql has no CREATE INDEX IF NOT EXISTS, the statement is built from information_schema like in the baseline
+SET @statement = (SELECT IF(COUNT(*) = 0, 'CREATE UNIQUE INDEX users_email ON users (Email)', 'DO 0') FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'users' AND INDEX_NAME = 'users_email');
+PREPARE statement FROM @statement;
+EXECUTE statement;
+DEALLOCATE PREPARE statement;
+
+SET @statement = (SELECT IF(COUNT(*) = 0, 'CREATE UNIQUE INDEX admins_email ON admins (Email)', 'DO 0') FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'admins' AND INDEX_NAME = 'admins_email');
+PREPARE statement FROM @statement;
+EXECUTE statement;
+DEALLOCATE PREPARE statement;
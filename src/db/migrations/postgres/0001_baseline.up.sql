@@ -0,0 +1,186 @@
+-- first schema on postgres, the same tables the mysql baseline creates
+
+CREATE TABLE IF NOT EXISTS admins (
+	AdminID varchar(36) NOT NULL PRIMARY KEY,
+	Email text NOT NULL,
+	UserName text NOT NULL,
+	Password text NOT NULL,
+	Created int NOT NULL,
+	-- set by admins, the next login has to change the password before it gets tokens
+	MustChangePassword boolean NOT NULL DEFAULT FALSE
+);
+
+-- the initial admins, the database is new so there are no others yet
+INSERT INTO admins (AdminID, Email, UserName, Password, Created) VALUES
+	('99278b45-63d3-11ef-9353-0242c0a8b502', 'julian.boehne@web.de', 'Julian', '$2a$12$vQmM9YShnUlX9ZZFRXwNOuRkbNmi8dSMjHfx0wKekXJZeoeGT4dvO', 1724694578),
+	('d23d9df9-63d3-11ef-9353-0242c0a8b502', 'wolf_david@gmx.de', 'David', '$2a$12$foK/kJYQn6QjlOTFXIw9FODo2motgflWuM2xTA0agV/HqiVQ2inCu', 1724694649);
+
+CREATE TABLE IF NOT EXISTS users (
+	UserID varchar(36) NOT NULL PRIMARY KEY,
+	FirstName text NOT NULL,
+	LastName text NOT NULL,
+	Email text NOT NULL,
+	Password text NOT NULL,
+	Created int NOT NULL,
+	EmailVerified boolean NOT NULL DEFAULT FALSE,
+	MustChangePassword boolean NOT NULL DEFAULT FALSE,
+	-- password, magic_link or both
+	LoginMethods varchar(16) NOT NULL DEFAULT 'both'
+);
+
+-- refresh tokens are stored hashed, a family groups all tokens created by rotating one login
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	TokenHash varchar(64) NOT NULL PRIMARY KEY,
+	FamilyID varchar(36) NOT NULL,
+	PersonID varchar(36) NOT NULL,
+	PersonType int NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Created bigint NOT NULL,
+	Revoked boolean NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family ON refresh_tokens (FamilyID);
+
+-- access tokens revoked before they expire, rows can be removed once ExpiresAt has passed
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	TokenID varchar(36) NOT NULL PRIMARY KEY,
+	ExpiresAt bigint NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles (
+	Name varchar(64) NOT NULL PRIMARY KEY,
+	Description text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+	Name varchar(64) NOT NULL PRIMARY KEY,
+	Description text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+	RoleName varchar(64) NOT NULL,
+	PermissionName varchar(64) NOT NULL,
+	PRIMARY KEY (RoleName, PermissionName)
+);
+
+CREATE TABLE IF NOT EXISTS admin_roles (
+	AdminID varchar(36) NOT NULL,
+	RoleName varchar(64) NOT NULL,
+	PRIMARY KEY (AdminID, RoleName)
+);
+
+-- totp secrets of admins, Enabled is false until the first code was confirmed
+CREATE TABLE IF NOT EXISTS admin_mfa (
+	AdminID varchar(36) NOT NULL PRIMARY KEY,
+	Secret varchar(64) NOT NULL,
+	Enabled boolean NOT NULL DEFAULT FALSE,
+	LastUsedStep bigint NOT NULL DEFAULT 0,
+	Created bigint NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS admin_recovery_codes (
+	CodeHash varchar(64) NOT NULL PRIMARY KEY,
+	AdminID varchar(36) NOT NULL,
+	Used boolean NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS admin_recovery_codes_admin ON admin_recovery_codes (AdminID);
+
+-- settings admins can change at runtime
+CREATE TABLE IF NOT EXISTS settings (
+	Name varchar(64) NOT NULL PRIMARY KEY,
+	Value text NOT NULL
+);
+
+-- password reset tokens are stored hashed and can only be used once
+CREATE TABLE IF NOT EXISTS password_resets (
+	TokenHash varchar(64) NOT NULL PRIMARY KEY,
+	PersonID varchar(36) NOT NULL,
+	PersonType int NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Used boolean NOT NULL DEFAULT FALSE,
+	Created bigint NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS email_verifications (
+	TokenHash varchar(64) NOT NULL PRIMARY KEY,
+	UserID varchar(36) NOT NULL,
+	Email varchar(255) NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Created bigint NOT NULL
+);
+
+-- failed logins for the database backed rate limiter, IpAttempts is a json object
+CREATE TABLE IF NOT EXISTS login_attempts (
+	AttemptKey varchar(255) NOT NULL PRIMARY KEY,
+	AttemptCount int NOT NULL,
+	LastAttempt bigint NOT NULL,
+	BlockedUntil bigint NOT NULL,
+	IpAttempts text NOT NULL
+);
+
+-- one row per login, the refresh token family and the jti of access tokens are the SessionID
+CREATE TABLE IF NOT EXISTS sessions (
+	SessionID varchar(36) NOT NULL PRIMARY KEY,
+	PersonID varchar(36) NOT NULL,
+	PersonType int NOT NULL,
+	UserAgent text NOT NULL,
+	IP varchar(45) NOT NULL,
+	Created bigint NOT NULL,
+	LastSeen bigint NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Revoked boolean NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS sessions_person ON sessions (PersonID, PersonType);
+
+-- keys are looked up by their prefix, only the sha256 of the whole key is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+	KeyID varchar(36) NOT NULL PRIMARY KEY,
+	Name varchar(255) NOT NULL,
+	Prefix varchar(16) NOT NULL UNIQUE,
+	KeyHash char(64) NOT NULL,
+	Scopes text NOT NULL,
+	CreatedBy varchar(36) NOT NULL,
+	Created bigint NOT NULL,
+	LastUsed bigint NOT NULL DEFAULT 0,
+	Revoked boolean NOT NULL DEFAULT FALSE
+);
+
+-- links the subject of an identity provider to an admin
+CREATE TABLE IF NOT EXISTS admin_identities (
+	Issuer varchar(255) NOT NULL,
+	Subject varchar(255) NOT NULL,
+	AdminID varchar(36) NOT NULL,
+	Created bigint NOT NULL,
+	PRIMARY KEY (Issuer, Subject)
+);
+
+CREATE INDEX IF NOT EXISTS admin_identities_admin ON admin_identities (AdminID);
+
+-- the links are signed tokens, the table makes sure every link logs in only once
+CREATE TABLE IF NOT EXISTS magic_links (
+	TokenID varchar(36) NOT NULL PRIMARY KEY,
+	UserID varchar(36) NOT NULL,
+	Email varchar(255) NOT NULL,
+	ExpiresAt bigint NOT NULL,
+	Used boolean NOT NULL DEFAULT FALSE,
+	Created bigint NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	ID bigint GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+	ActorID varchar(36) NOT NULL,
+	ActorType int NOT NULL,
+	SubjectID varchar(36) NOT NULL,
+	SubjectType int NOT NULL,
+	Action text NOT NULL,
+	Status int NOT NULL,
+	IP varchar(45) NOT NULL,
+	Created bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (ActorID);
+
+CREATE INDEX IF NOT EXISTS audit_log_subject ON audit_log (SubjectID);
+
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS admins_email;
+DROP INDEX IF EXISTS users_email;
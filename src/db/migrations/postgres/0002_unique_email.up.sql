@@ -0,0 +1,18 @@
+-- existing duplicates abort the migration before anything is changed, see "Duplicate emails" in the README.
+-- the named CHECK constraints make the error tell which table has them
+CREATE TEMPORARY TABLE email_duplicates (
+	Users int NOT NULL CONSTRAINT resolve_duplicate_user_emails_first CHECK (Users = 0),
+	Admins int NOT NULL CONSTRAINT resolve_duplicate_admin_emails_first CHECK (Admins = 0)
+);
+INSERT INTO email_duplicates (Users, Admins) SELECT
+	(SELECT COUNT(*) FROM (SELECT LOWER(TRIM(Email)) AS Email FROM users GROUP BY LOWER(TRIM(Email)) HAVING COUNT(*) > 1) AS duplicates),
+	(SELECT COUNT(*) FROM (SELECT LOWER(TRIM(Email)) AS Email FROM admins GROUP BY LOWER(TRIM(Email)) HAVING COUNT(*) > 1) AS duplicates);
+DROP TABLE email_duplicates;
+
+-- emails are stored trimmed and in lower case, existing addresses are normalized before the index is created
+UPDATE users SET Email = LOWER(TRIM(Email));
+UPDATE admins SET Email = LOWER(TRIM(Email));
+
+-- the index compares in lower case, so addresses differing only in case can't be stored twice
+CREATE UNIQUE INDEX IF NOT EXISTS users_email ON users (LOWER(Email));
+CREATE UNIQUE INDEX IF NOT EXISTS admins_email ON admins (LOWER(Email));
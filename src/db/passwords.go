@@ -0,0 +1,328 @@
+package db
+
+import (
+	"backend/src/store"
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// hasher creates all new password hashes, existing hashes of other algorithms or costs are upgraded at login
+var hasher utils.PasswordHasher = &utils.BcryptHasher{Cost: 12}
+
+func SetPasswordHasher(h utils.PasswordHasher) {
+	hasher = h
+}
+
+// getPersonIDByEmail returns the ID of the user or admin with the email
+func getPersonIDByEmail(ctx context.Context, person customTypes.Person, email string) (string, error) {
+	email = store.NormalizeEmail(email)
+
+	var id string
+	var err error
+
+	switch person {
+	case customTypes.USER:
+		err = db.QueryRowContext(ctx, `SELECT UserID FROM users WHERE Email = ?`, email).Scan(&id)
+	case customTypes.ADMIN:
+		err = db.QueryRowContext(ctx, `SELECT AdminID FROM admins WHERE Email = ?`, email).Scan(&id)
+	default:
+		return "", errors.New("invalid person type")
+	}
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("email doesn't exist")
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error occured getting email from db %w", err)
+	}
+
+	return id, nil
+}
+
+// getEmailByPersonID returns the email of the user or admin
+func getEmailByPersonID(ctx context.Context, person customTypes.Person, id string) (string, error) {
+	var email string
+	var err error
+
+	switch person {
+	case customTypes.USER:
+		err = db.QueryRowContext(ctx, `SELECT Email FROM users WHERE UserID = ?`, id).Scan(&email)
+	case customTypes.ADMIN:
+		err = db.QueryRowContext(ctx, `SELECT Email FROM admins WHERE AdminID = ?`, id).Scan(&email)
+	default:
+		return "", errors.New("invalid person type")
+	}
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("person not found")
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error occured getting email from db %w", err)
+	}
+
+	return email, nil
+}
+
+// checkPassword compares the password with the stored hash of the user or admin
+func checkPassword(ctx context.Context, person customTypes.Person, id, password string) error {
+	var hashedPassword string
+	var err error
+
+	switch person {
+	case customTypes.USER:
+		err = db.QueryRowContext(ctx, `SELECT Password FROM users WHERE UserID = ?`, id).Scan(&hashedPassword)
+	case customTypes.ADMIN:
+		err = db.QueryRowContext(ctx, `SELECT Password FROM admins WHERE AdminID = ?`, id).Scan(&hashedPassword)
+	default:
+		return errors.New("invalid person type")
+	}
+
+	if err == sql.ErrNoRows {
+		return errors.New("person not found")
+	}
+
+	if err != nil {
+		return fmt.Errorf("error occured getting password from db %w", err)
+	}
+
+	if !utils.VerifyPassword(hashedPassword, password) {
+		return errors.New("wrong password")
+	}
+
+	return nil
+}
+
+// setPassword hashes the new password and stores it, a pending forced password change is done with it
+func setPassword(ctx context.Context, person customTypes.Person, id, password string) error {
+	hashedPassword, err := hasher.Hash(password)
+
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+
+	switch person {
+	case customTypes.USER:
+		result, err = db.ExecContext(ctx, `UPDATE users SET Password = ?, MustChangePassword = ? WHERE UserID = ?`, hashedPassword, false, id)
+	case customTypes.ADMIN:
+		result, err = db.ExecContext(ctx, `UPDATE admins SET Password = ?, MustChangePassword = ? WHERE AdminID = ?`, hashedPassword, false, id)
+	default:
+		return errors.New("invalid person type")
+	}
+
+	if err != nil {
+		return fmt.Errorf("error while updating password %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("error while checking affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("no rows affected")
+	}
+
+	return nil
+}
+
+// authenticate checks the password and upgrades its hash if it was created with an outdated algorithm or cost
+func authenticate(ctx context.Context, person customTypes.Person, email, password string) (string, error) {
+	email = store.NormalizeEmail(email)
+
+	var requiredPassword string
+	var personID string
+	var err error
+
+	switch person {
+	case customTypes.USER:
+		err = db.QueryRowContext(ctx, `SELECT UserID, Password FROM users where email = ?`, email).Scan(&personID, &requiredPassword)
+	case customTypes.ADMIN:
+		err = db.QueryRowContext(ctx, `SELECT AdminID, Password FROM admins where email = ?`, email).Scan(&personID, &requiredPassword)
+	default:
+		return "", errors.New("invalid person type")
+	}
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("email doesn't exist")
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error while logging in %w", err)
+	}
+
+	if !utils.VerifyPassword(requiredPassword, password) {
+		return "", errors.New("wrong password")
+	}
+
+	if hasher.NeedsRehash(requiredPassword) {
+		rehashPassword(ctx, person, personID, password)
+	}
+
+	return personID, nil
+}
+
+// rehashPassword replaces an outdated hash after the password was verified, failures only cost the upgrade
+func rehashPassword(ctx context.Context, person customTypes.Person, id, password string) {
+	hashedPassword, err := hasher.Hash(password)
+
+	if err == nil {
+		switch person {
+		case customTypes.USER:
+			_, err = db.ExecContext(ctx, `UPDATE users SET Password = ? WHERE UserID = ?`, hashedPassword, id)
+		case customTypes.ADMIN:
+			_, err = db.ExecContext(ctx, `UPDATE admins SET Password = ? WHERE AdminID = ?`, hashedPassword, id)
+		}
+	}
+
+	if err != nil {
+		fmt.Println("Server: Error upgrading password hash: ", err.Error())
+	}
+}
+
+// mustChangePassword reports if an admin requested a password change of the account
+func mustChangePassword(ctx context.Context, person customTypes.Person, id string) (bool, error) {
+	var mustChange bool
+	var err error
+
+	switch person {
+	case customTypes.USER:
+		err = db.QueryRowContext(ctx, `SELECT MustChangePassword FROM users WHERE UserID = ?`, id).Scan(&mustChange)
+	case customTypes.ADMIN:
+		err = db.QueryRowContext(ctx, `SELECT MustChangePassword FROM admins WHERE AdminID = ?`, id).Scan(&mustChange)
+	default:
+		return false, errors.New("invalid person type")
+	}
+
+	if err == sql.ErrNoRows {
+		return false, errors.New("person not found")
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error occured getting password flag from db %w", err)
+	}
+
+	return mustChange, nil
+}
+
+func setMustChangePassword(ctx context.Context, person customTypes.Person, id string, mustChange bool) error {
+	// the update reports no affected rows if the flag didn't change, so the account is looked up first
+	_, err := getEmailByPersonID(ctx, person, id)
+
+	if err != nil {
+		return err
+	}
+
+	switch person {
+	case customTypes.USER:
+		_, err = db.ExecContext(ctx, `UPDATE users SET MustChangePassword = ? WHERE UserID = ?`, mustChange, id)
+	case customTypes.ADMIN:
+		_, err = db.ExecContext(ctx, `UPDATE admins SET MustChangePassword = ? WHERE AdminID = ?`, mustChange, id)
+	default:
+		return errors.New("invalid person type")
+	}
+
+	if err != nil {
+		return fmt.Errorf("error while updating password flag %w", err)
+	}
+
+	return nil
+}
+
+// PasswordResetStore keeps the hashes of password reset tokens
+type PasswordResetStore struct{}
+
+func NewPasswordResetStore() *PasswordResetStore {
+	return &PasswordResetStore{}
+}
+
+func (s *PasswordResetStore) Save(ctx context.Context, reset *customTypes.PasswordReset) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO password_resets (TokenHash, PersonID, PersonType, ExpiresAt, Used, Created) VALUES (?, ?, ?, ?, ?, ?)`, reset.TokenHash, reset.PersonID, reset.PersonType, reset.ExpiresAt, false, reset.Created)
+
+	if err != nil {
+		return fmt.Errorf("couldn't store password reset: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns an open reset without using it up, e.g. to validate the new password first
+func (s *PasswordResetStore) Get(ctx context.Context, tokenHash string) (*customTypes.PasswordReset, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var reset customTypes.PasswordReset
+
+	err := db.QueryRowContext(ctx, `SELECT TokenHash, PersonID, PersonType, ExpiresAt, Used, Created FROM password_resets WHERE TokenHash = ? AND Used = ? AND ExpiresAt >= ?`, tokenHash, false, time.Now().Unix()).Scan(&reset.TokenHash, &reset.PersonID, &reset.PersonType, &reset.ExpiresAt, &reset.Used, &reset.Created)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("invalid or expired reset token")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting password reset from db %w", err)
+	}
+
+	return &reset, nil
+}
+
+/*
+Consume marks the reset token as used and returns it.
+It fails if the token doesn't exist, expired or was used before
+*/
+func (s *PasswordResetStore) Consume(ctx context.Context, tokenHash string) (*customTypes.PasswordReset, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE password_resets SET Used = ? WHERE TokenHash = ? AND Used = ? AND ExpiresAt >= ?`, true, tokenHash, false, time.Now().Unix())
+
+	if err != nil {
+		return nil, fmt.Errorf("error while updating db %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return nil, fmt.Errorf("error while checking affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, errors.New("invalid or expired reset token")
+	}
+
+	var reset customTypes.PasswordReset
+
+	err = db.QueryRowContext(ctx, `SELECT TokenHash, PersonID, PersonType, ExpiresAt, Used, Created FROM password_resets WHERE TokenHash = ?`, tokenHash).Scan(&reset.TokenHash, &reset.PersonID, &reset.PersonType, &reset.ExpiresAt, &reset.Used, &reset.Created)
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting password reset from db %w", err)
+	}
+
+	return &reset, nil
+}
+
+// DeleteOfPerson removes every open reset of a person and expired resets of everyone
+func (s *PasswordResetStore) DeleteOfPerson(ctx context.Context, person customTypes.Person, id string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM password_resets WHERE (PersonID = ? AND PersonType = ?) OR ExpiresAt < ?`, id, person, time.Now().Unix())
+
+	if err != nil {
+		return fmt.Errorf("error while deleting password resets %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RoleStore reads the roles and permissions seeded into the database
+type RoleStore struct{}
+
+func NewRoleStore() *RoleStore {
+	return &RoleStore{}
+}
+
+func (s *RoleStore) List(ctx context.Context) (*[]customTypes.Role, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT Name, Description FROM roles ORDER BY Name`)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	defer rows.Close()
+
+	roleList := []customTypes.Role{}
+
+	for rows.Next() {
+		var current customTypes.Role
+
+		err := rows.Scan(&current.Name, &current.Description)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while appending roles %w", err)
+		}
+
+		roleList = append(roleList, current)
+	}
+
+	for i := range roleList {
+		permissions, err := s.GetPermissions(ctx, []string{roleList[i].Name})
+
+		if err != nil {
+			return nil, err
+		}
+
+		roleList[i].Permissions = permissions
+	}
+
+	return &roleList, nil
+}
+
+func getAdminRoles(ctx context.Context, adminID string) ([]string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT RoleName FROM admin_roles WHERE AdminID = ? ORDER BY RoleName`, adminID)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	defer rows.Close()
+
+	roles := []string{}
+
+	for rows.Next() {
+		var role string
+
+		err := rows.Scan(&role)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while reading admin roles %w", err)
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// GetPermissions returns every permission granted by at least one of the roles
+func (s *RoleStore) GetPermissions(ctx context.Context, roles []string) ([]string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	permissions := []string{}
+
+	if len(roles) == 0 {
+		return permissions, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(roles)), ", ")
+
+	args := make([]any, 0, len(roles))
+	for _, role := range roles {
+		args = append(args, role)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT PermissionName FROM role_permissions WHERE RoleName IN (`+placeholders+`) ORDER BY PermissionName`, args...)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while reading permissions %w", err)
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, nil
+}
+
+// setAdminRoles replaces all roles of an admin, the last superadmin can't lose the role
+func setAdminRoles(ctx context.Context, adminID string, roles []string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err := validateRoles(ctx, roles)
+
+	if err != nil {
+		return err
+	}
+
+	keepsSuperadmin := false
+	for _, role := range roles {
+		if role == customTypes.RoleSuperadmin {
+			keepsSuperadmin = true
+		}
+	}
+
+	if !keepsSuperadmin {
+		err = ensureOtherSuperadmin(ctx, adminID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.BeginTx(ctx)
+
+	if err != nil {
+		return fmt.Errorf("couldn't start transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM admin_roles WHERE AdminID = ?`, adminID)
+
+	if err != nil {
+		return fmt.Errorf("error while removing admin roles %w", err)
+	}
+
+	for _, role := range roles {
+		_, err = tx.ExecContext(ctx, `INSERT INTO admin_roles (AdminID, RoleName) VALUES (?, ?)`, adminID, role)
+
+		if err != nil {
+			return fmt.Errorf("error while assigning admin role %w", err)
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return fmt.Errorf("couldn't commit admin roles: %w", err)
+	}
+
+	return nil
+}
+
+func validateRoles(ctx context.Context, roles []string) error {
+	for _, role := range roles {
+		var name string
+
+		err := db.QueryRowContext(ctx, `SELECT Name FROM roles WHERE Name = ?`, role).Scan(&name)
+
+		if err == sql.ErrNoRows {
+			return errors.New("role " + role + " doesn't exist")
+		}
+
+		if err != nil {
+			return fmt.Errorf("couldn't execute role search in database: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ensureOtherSuperadmin fails if the admin is the only one left who can manage admins
+func ensureOtherSuperadmin(ctx context.Context, adminID string) error {
+	var others int
+
+	err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_roles WHERE RoleName = ? AND AdminID <> ?`, customTypes.RoleSuperadmin, adminID).Scan(&others)
+
+	if err != nil {
+		return fmt.Errorf("couldn't count superadmins: %w", err)
+	}
+
+	if others == 0 {
+		var isSuperadmin int
+
+		err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM admin_roles WHERE RoleName = ? AND AdminID = ?`, customTypes.RoleSuperadmin, adminID).Scan(&isSuperadmin)
+
+		if err != nil {
+			return fmt.Errorf("couldn't count superadmins: %w", err)
+		}
+
+		if isSuperadmin > 0 {
+			return errors.New("the last superadmin can't be removed")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SessionStore keeps the sessions of users and admins and the refresh tokens rotated within them
+type SessionStore struct{}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{}
+}
+
+func (s *SessionStore) Create(ctx context.Context, session *customTypes.Session) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO sessions (SessionID, PersonID, PersonType, UserAgent, IP, Created, LastSeen, ExpiresAt, Revoked) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, session.ID, session.PersonID, session.PersonType, session.UserAgent, session.IP, session.Created, session.LastSeen, session.ExpiresAt, false)
+
+	if err != nil {
+		return fmt.Errorf("couldn't store session: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SessionStore) Get(ctx context.Context, sessionID string) (*customTypes.Session, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var session customTypes.Session
+
+	err := db.QueryRowContext(ctx, `SELECT SessionID, PersonID, PersonType, UserAgent, IP, Created, LastSeen, ExpiresAt, Revoked FROM sessions WHERE SessionID = ?`, sessionID).Scan(&session.ID, &session.PersonID, &session.PersonType, &session.UserAgent, &session.IP, &session.Created, &session.LastSeen, &session.ExpiresAt, &session.Revoked)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("session not found")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting session from db %w", err)
+	}
+
+	return &session, nil
+}
+
+// ListOfPerson returns the active sessions of a user or admin, the newest first
+func (s *SessionStore) ListOfPerson(ctx context.Context, person customTypes.Person, personID string) (*[]customTypes.Session, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT SessionID, PersonID, PersonType, UserAgent, IP, Created, LastSeen, ExpiresAt, Revoked FROM sessions WHERE PersonID = ? AND PersonType = ? AND Revoked = ? AND ExpiresAt >= ? ORDER BY LastSeen DESC`, personID, person, false, time.Now().Unix())
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	defer rows.Close()
+
+	sessionList := []customTypes.Session{}
+
+	for rows.Next() {
+		var current customTypes.Session
+
+		err := rows.Scan(&current.ID, &current.PersonID, &current.PersonType, &current.UserAgent, &current.IP, &current.Created, &current.LastSeen, &current.ExpiresAt, &current.Revoked)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while appending sessions %w", err)
+		}
+
+		sessionList = append(sessionList, current)
+	}
+
+	return &sessionList, nil
+}
+
+// Touch updates LastSeen, at most once per minute so not every request writes to the db
+func (s *SessionStore) Touch(ctx context.Context, sessionID string, now time.Time) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE sessions SET LastSeen = ? WHERE SessionID = ? AND LastSeen < ?`, now.Unix(), sessionID, now.Add(-time.Minute).Unix())
+
+	if err != nil {
+		return fmt.Errorf("error while updating session %w", err)
+	}
+
+	return nil
+}
+
+// Extend is called when the refresh token is rotated, the session lives as long as its refresh token
+func (s *SessionStore) Extend(ctx context.Context, sessionID string, now time.Time, expiresAt int64) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE sessions SET LastSeen = ?, ExpiresAt = ? WHERE SessionID = ?`, now.Unix(), expiresAt, sessionID)
+
+	if err != nil {
+		return fmt.Errorf("error while updating session %w", err)
+	}
+
+	return nil
+}
+
+// Revoke ends the session and every refresh token of it
+func (s *SessionStore) Revoke(ctx context.Context, sessionID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE sessions SET Revoked = ? WHERE SessionID = ?`, true, sessionID)
+
+	if err != nil {
+		return fmt.Errorf("error while revoking session %w", err)
+	}
+
+	return revokeRefreshTokenFamily(ctx, sessionID)
+}
+
+// RevokeOfPerson logs a user or admin out everywhere
+func (s *SessionStore) RevokeOfPerson(ctx context.Context, person customTypes.Person, personID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE sessions SET Revoked = ? WHERE PersonID = ? AND PersonType = ?`, true, personID, person)
+
+	if err != nil {
+		return fmt.Errorf("error while revoking sessions %w", err)
+	}
+
+	return revokeRefreshTokensOfPerson(ctx, person, personID)
+}
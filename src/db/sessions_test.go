@@ -0,0 +1,105 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRefreshTokenReuse(t *testing.T) {
+	openSQLite(t)
+	migrateUp(t)
+
+	ctx := context.Background()
+	sessions := NewSessionStore()
+	now := time.Now()
+
+	for _, sessionID := range []string{"session-1", "session-2"} {
+		err := sessions.Create(ctx, &customTypes.Session{ID: sessionID, PersonID: "user-1", PersonType: customTypes.USER, Created: now.Unix(), LastSeen: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first two tokens were rotated within session-1, the third belongs to another login
+	for _, token := range []customTypes.RefreshToken{
+		{TokenHash: "hash-1", FamilyID: "session-1"},
+		{TokenHash: "hash-2", FamilyID: "session-1"},
+		{TokenHash: "hash-3", FamilyID: "session-2"},
+	} {
+		token.PersonID = "user-1"
+		token.PersonType = customTypes.USER
+		token.ExpiresAt = now.Add(time.Hour).Unix()
+		token.Created = now.Unix()
+
+		err := sessions.SaveRefreshToken(ctx, &token)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	consumes := []struct {
+		name     string
+		hash     string
+		consumed bool
+	}{
+		{name: "first use", hash: "hash-1", consumed: true},
+		{name: "reuse", hash: "hash-1", consumed: false},
+		{name: "unknown token", hash: "hash-unknown", consumed: false},
+	}
+
+	for _, consume := range consumes {
+		consumed, err := sessions.ConsumeRefreshToken(ctx, consume.hash)
+		if err != nil {
+			t.Fatalf("%s: %v", consume.name, err)
+		}
+
+		if consumed != consume.consumed {
+			t.Errorf("%s: got consumed %t, want %t", consume.name, consumed, consume.consumed)
+		}
+	}
+
+	// the handler revokes the session of a reused token, every token rotated within it ends with it
+	err := sessions.Revoke(ctx, "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revoked := map[string]bool{"hash-1": true, "hash-2": true, "hash-3": false}
+
+	for hash, want := range revoked {
+		token, err := sessions.GetRefreshToken(ctx, hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if token.Revoked != want {
+			t.Errorf("%s: got revoked %t, want %t", hash, token.Revoked, want)
+		}
+	}
+
+	active, err := sessions.ListOfPerson(ctx, customTypes.USER, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*active) != 1 || (*active)[0].ID != "session-2" {
+		t.Errorf("got active sessions %+v, want only session-2", *active)
+	}
+
+	// logging out everywhere ends the other login as well
+	err = sessions.RevokeOfPerson(ctx, customTypes.USER, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consumed, err := sessions.ConsumeRefreshToken(ctx, "hash-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if consumed {
+		t.Error("refresh token of a revoked person was consumed")
+	}
+}
@@ -0,0 +1,172 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RevocationStore keeps the IDs of revoked access tokens until they expire
+type RevocationStore struct{}
+
+func NewRevocationStore() *RevocationStore {
+	return &RevocationStore{}
+}
+
+func (s *SessionStore) SaveRefreshToken(ctx context.Context, token *customTypes.RefreshToken) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO refresh_tokens (TokenHash, FamilyID, PersonID, PersonType, ExpiresAt, Created, Revoked) VALUES (?, ?, ?, ?, ?, ?, ?)`, token.TokenHash, token.FamilyID, token.PersonID, token.PersonType, token.ExpiresAt, token.Created, false)
+
+	if err != nil {
+		return fmt.Errorf("couldn't store refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SessionStore) GetRefreshToken(ctx context.Context, tokenHash string) (*customTypes.RefreshToken, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var token customTypes.RefreshToken
+
+	err := db.QueryRowContext(ctx, `SELECT TokenHash, FamilyID, PersonID, PersonType, ExpiresAt, Created, Revoked FROM refresh_tokens WHERE TokenHash = ?`, tokenHash).Scan(&token.TokenHash, &token.FamilyID, &token.PersonID, &token.PersonType, &token.ExpiresAt, &token.Created, &token.Revoked)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("refresh token not found")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting refresh token from db %w", err)
+	}
+
+	return &token, nil
+}
+
+// ConsumeRefreshToken revokes a refresh token so it can only be rotated once,
+// false is returned if the token was already used before
+func (s *SessionStore) ConsumeRefreshToken(ctx context.Context, tokenHash string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `UPDATE refresh_tokens SET Revoked = ? WHERE TokenHash = ? AND Revoked = ?`, true, tokenHash, false)
+
+	if err != nil {
+		return false, fmt.Errorf("error while updating db %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return false, fmt.Errorf("error while checking affected rows: %w", err)
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// revokeRefreshTokenFamily revokes every refresh token created from the same login
+func revokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE refresh_tokens SET Revoked = ? WHERE FamilyID = ?`, true, familyID)
+
+	if err != nil {
+		return fmt.Errorf("error while revoking refresh tokens %w", err)
+	}
+
+	return nil
+}
+
+func (s *RevocationStore) Revoke(ctx context.Context, tokenID string, expiresAt int64) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	revoked, err := s.IsRevoked(ctx, tokenID)
+
+	if err != nil || revoked {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `INSERT INTO revoked_tokens (TokenID, ExpiresAt) VALUES (?, ?)`, tokenID, expiresAt)
+
+	if err != nil {
+		return fmt.Errorf("couldn't revoke access token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RevocationStore) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var id string
+
+	err := db.QueryRowContext(ctx, `SELECT TokenID FROM revoked_tokens WHERE TokenID = ?`, tokenID).Scan(&id)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error occured checking revoked tokens %w", err)
+	}
+
+	return true, nil
+}
+
+// DeleteExpired removes sessions and refresh tokens which are no longer needed because they expired anyway
+func (s *SessionStore) DeleteExpired(ctx context.Context) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now().Unix()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE ExpiresAt < ?`, now)
+
+	if err != nil {
+		return fmt.Errorf("error while deleting expired refresh tokens %w", err)
+	}
+
+	_, err = db.ExecContext(ctx, `DELETE FROM sessions WHERE ExpiresAt < ?`, now)
+
+	if err != nil {
+		return fmt.Errorf("error while deleting expired sessions %w", err)
+	}
+
+	return nil
+}
+
+// DeleteExpired forgets revoked access tokens which expired anyway
+func (s *RevocationStore) DeleteExpired(ctx context.Context) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE ExpiresAt < ?`, time.Now().Unix())
+
+	if err != nil {
+		return fmt.Errorf("error while deleting expired revoked tokens %w", err)
+	}
+
+	return nil
+}
+
+// revokeRefreshTokensOfPerson ends every login of a user or admin, e.g. after the password changed
+func revokeRefreshTokensOfPerson(ctx context.Context, person customTypes.Person, personID string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE refresh_tokens SET Revoked = ? WHERE PersonID = ? AND PersonType = ?`, true, personID, person)
+
+	if err != nil {
+		return fmt.Errorf("error while revoking refresh tokens %w", err)
+	}
+
+	return nil
+}
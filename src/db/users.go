@@ -0,0 +1,311 @@
+package db
+
+import (
+	"backend/src/store"
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserStore keeps users in the users table
+type UserStore struct{}
+
+func NewUserStore() *UserStore {
+	return &UserStore{}
+}
+
+func (s *UserStore) Authenticate(ctx context.Context, email, password string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return authenticate(ctx, customTypes.USER, email, password)
+}
+
+func (s *UserStore) GetIDByEmail(ctx context.Context, email string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return getPersonIDByEmail(ctx, customTypes.USER, email)
+}
+
+func (s *UserStore) GetEmail(ctx context.Context, id string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return getEmailByPersonID(ctx, customTypes.USER, id)
+}
+
+func (s *UserStore) CheckPassword(ctx context.Context, id, password string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return checkPassword(ctx, customTypes.USER, id, password)
+}
+
+func (s *UserStore) SetPassword(ctx context.Context, id, password string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return setPassword(ctx, customTypes.USER, id, password)
+}
+
+func (s *UserStore) MustChangePassword(ctx context.Context, id string) (bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return mustChangePassword(ctx, customTypes.USER, id)
+}
+
+func (s *UserStore) SetMustChangePassword(ctx context.Context, id string, mustChange bool) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	return setMustChangePassword(ctx, customTypes.USER, id, mustChange)
+}
+
+func (s *UserStore) Register(ctx context.Context, usr customTypes.RegisterUserRequest) (*customTypes.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// create new user, the password is hashed before the transaction so it doesn't hold the connection meanwhile
+	var newUser customTypes.User
+	var IDerr error
+	newUser.ID, IDerr = uuid.NewUUID()
+
+	if IDerr != nil {
+		return nil, errors.New("couldn't generate UUID: " + IDerr.Error())
+	}
+
+	newUser.Created = int(time.Now().Unix())
+
+	hashedPassword, err := hasher.Hash(usr.Password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	newUser.Password = hashedPassword
+
+	newUser.Email = store.NormalizeEmail(usr.Email)
+	newUser.FirstName = usr.FirstName
+	newUser.LastName = usr.LastName
+
+	tx, err := db.BeginTx(ctx)
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't start transaction: %w", err)
+	}
+
+	defer tx.Rollback()
+
+	var mail string
+
+	err = tx.QueryRowContext(ctx, `SELECT Email FROM users where Email = ?`, newUser.Email).Scan(&mail)
+
+	if err == nil {
+		return nil, store.ErrEmailInUse
+	}
+
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("couldn't execute user search in database: %w", err)
+	}
+
+	// the unique index rejects a concurrent registration the search didn't see yet
+	_, err = tx.ExecContext(ctx, `INSERT INTO users (UserID, FirstName, LastName, Email, Password, Created, EmailVerified) VALUES (?, ?, ?, ?, ?, ?, ?)`, newUser.ID, newUser.FirstName, newUser.LastName, newUser.Email, newUser.Password, newUser.Created, false)
+
+	if db.dialect.IsUniqueViolation(err) {
+		return nil, store.ErrEmailInUse
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute user creation on db: %w", err)
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		return nil, fmt.Errorf("couldn't commit user creation: %w", err)
+	}
+
+	fmt.Println("Server: New user created: ID: ", newUser.ID)
+
+	return &newUser, nil
+}
+
+func (s *UserStore) GetByID(ctx context.Context, usrID string) (*customTypes.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var usr customTypes.User
+
+	err := db.QueryRowContext(ctx, `SELECT UserID, FirstName, LastName, Email, Created, EmailVerified FROM users WHERE UserID = ?`, usrID).Scan(&usr.ID, &usr.FirstName, &usr.LastName, &usr.Email, &usr.Created, &usr.EmailVerified)
+
+	if err == sql.ErrNoRows {
+		return nil, errors.New("user not found")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error occured getting user from db %w", err)
+	}
+
+	return &usr, nil
+}
+
+func (s *UserStore) List(ctx context.Context, quantity int) ([]customTypes.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT UserID, FirstName, LastName, Email, Created, EmailVerified FROM users LIMIT ?`, quantity)
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	return scanUsers(rows)
+}
+
+func (s *UserStore) Search(ctx context.Context, usrRequest *customTypes.SearchUserRequest) ([]customTypes.User, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, `SELECT UserID, FirstName, LastName, Email, Created, EmailVerified FROM users WHERE UserId = ? OR LOWER(FirstName) LIKE ? OR LOWER(LastName) LIKE ? OR LOWER(Email) LIKE ?`, usrRequest.ID, "%"+strings.ToLower(usrRequest.FirstName)+"%", "%"+strings.ToLower(usrRequest.LastName)+"%", "%"+strings.ToLower(usrRequest.Email)+"%")
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to perform query %w", err)
+	}
+
+	return scanUsers(rows)
+}
+
+func scanUsers(rows *sql.Rows) ([]customTypes.User, error) {
+	var userList []customTypes.User
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var current customTypes.User
+
+		err := rows.Scan(&current.ID, &current.FirstName, &current.LastName, &current.Email, &current.Created, &current.EmailVerified)
+
+		if err != nil {
+			return nil, fmt.Errorf("error while appending users %w", err)
+		}
+
+		userList = append(userList, current)
+	}
+
+	return userList, nil
+}
+
+func (s *UserStore) Edit(ctx context.Context, id string, usr *customTypes.EditUserRequest) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	email := store.NormalizeEmail(usr.Email)
+
+	// a changed email has to be verified again, EmailVerified is assigned before Email so it compares the old email
+	result, err := db.ExecContext(ctx, `UPDATE users SET FirstName = ?, LastName = ?, EmailVerified = CASE WHEN Email = ? THEN EmailVerified ELSE FALSE END, Email = ? WHERE UserID = ?`, usr.FirstName, usr.LastName, email, email, id)
+
+	if db.dialect.IsUniqueViolation(err) {
+		return store.ErrEmailInUse
+	}
+
+	if err != nil {
+		return fmt.Errorf("error while updating db %w", err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+func (s *UserStore) Delete(ctx context.Context, id string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, `DELETE FROM users WHERE UserID = ?`, id)
+
+	if err != nil {
+		return fmt.Errorf("error while deleting db %w", err)
+	}
+
+	return checkRowsAffected(result)
+}
+
+func (s *UserStore) GetLoginMethods(ctx context.Context, userID string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var methods string
+
+	err := db.QueryRowContext(ctx, `SELECT LoginMethods FROM users WHERE UserID = ?`, userID).Scan(&methods)
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("user not found")
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error occured getting login methods from db %w", err)
+	}
+
+	return methods, nil
+}
+
+func (s *UserStore) SetLoginMethods(ctx context.Context, userID, methods string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	switch methods {
+	case customTypes.LoginMethodPassword, customTypes.LoginMethodMagicLink, customTypes.LoginMethodBoth:
+	default:
+		return errors.New("invalid login methods " + methods)
+	}
+
+	// the update reports no affected rows if nothing changed, so the user is looked up first
+	_, err := s.GetLoginMethods(ctx, userID)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, `UPDATE users SET LoginMethods = ? WHERE UserID = ?`, methods, userID)
+
+	if err != nil {
+		return fmt.Errorf("error while updating login methods %w", err)
+	}
+
+	return nil
+}
+
+// MarkEmailVerified verifies the email if the user still has it, opening a mailed login link proves ownership
+func (s *UserStore) MarkEmailVerified(ctx context.Context, userID, email string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `UPDATE users SET EmailVerified = ? WHERE UserID = ? AND Email = ?`, true, userID, store.NormalizeEmail(email))
+
+	if err != nil {
+		return fmt.Errorf("error while updating db %w", err)
+	}
+
+	return nil
+}
+
+// checkRowsAffected fails if an update or delete didn't find the row
+func checkRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return fmt.Errorf("error while checking affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return errors.New("no rows affected")
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// VerificationStore keeps the tokens of email verification links and marks the emails as verified
+type VerificationStore struct{}
+
+func NewVerificationStore() *VerificationStore {
+	return &VerificationStore{}
+}
+
+// Save stores a new verification token, older tokens of the user stay valid until they expire
+func (s *VerificationStore) Save(ctx context.Context, verification *customTypes.EmailVerification) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `INSERT INTO email_verifications (TokenHash, UserID, Email, ExpiresAt, Created) VALUES (?, ?, ?, ?, ?)`, verification.TokenHash, verification.UserID, verification.Email, verification.ExpiresAt, verification.Created)
+
+	if err != nil {
+		return fmt.Errorf("couldn't store email verification: %w", err)
+	}
+
+	return nil
+}
+
+/*
+Verify marks the email of the token as verified and removes the user's open verifications.
+Tokens for an email the user no longer has are rejected
+*/
+func (s *VerificationStore) Verify(ctx context.Context, tokenHash string) (string, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var verification customTypes.EmailVerification
+
+	err := db.QueryRowContext(ctx, `SELECT TokenHash, UserID, Email, ExpiresAt, Created FROM email_verifications WHERE TokenHash = ?`, tokenHash).Scan(&verification.TokenHash, &verification.UserID, &verification.Email, &verification.ExpiresAt, &verification.Created)
+
+	if err == sql.ErrNoRows {
+		return "", errors.New("invalid verification token")
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("error occured getting verification from db %w", err)
+	}
+
+	if verification.ExpiresAt < time.Now().Unix() {
+		return "", errors.New("verification token expired")
+	}
+
+	result, err := db.ExecContext(ctx, `UPDATE users SET EmailVerified = ? WHERE UserID = ? AND Email = ?`, true, verification.UserID, verification.Email)
+
+	if err != nil {
+		return "", fmt.Errorf("error while updating db %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return "", fmt.Errorf("error while checking affected rows: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		var verified bool
+
+		// mysql reports 0 affected rows if the email was verified already
+		err = db.QueryRowContext(ctx, `SELECT EmailVerified FROM users WHERE UserID = ? AND Email = ?`, verification.UserID, verification.Email).Scan(&verified)
+
+		if err != nil || !verified {
+			return "", errors.New("email changed since the verification was sent")
+		}
+	}
+
+	_, err = db.ExecContext(ctx, `DELETE FROM email_verifications WHERE UserID = ? OR ExpiresAt < ?`, verification.UserID, time.Now().Unix())
+
+	if err != nil {
+		return "", fmt.Errorf("error while deleting verifications %w", err)
+	}
+
+	return verification.UserID, nil
+}
@@ -0,0 +1,129 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends mails, the implementation is chosen with MAIL_DRIVER
+type Mailer interface {
+	Send(message Message) error
+}
+
+/*
+NewMailerFromEnv creates the mailer configured in the environment:
+MAIL_DRIVER=smtp sends through SMTP_HOST:SMTP_PORT, everything else writes mails to MAIL_LOG_FILE or stdout
+*/
+func NewMailerFromEnv() Mailer {
+	from := os.Getenv("MAIL_FROM")
+
+	if from == "" {
+		from = "noreply@localhost"
+	}
+
+	if os.Getenv("MAIL_DRIVER") == "smtp" {
+		port := os.Getenv("SMTP_PORT")
+
+		if port == "" {
+			port = "25"
+		}
+
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     from,
+		}
+	}
+
+	return &LogMailer{File: os.Getenv("MAIL_LOG_FILE"), From: from}
+}
+
+// SMTPMailer delivers mails to a SMTP server, STARTTLS is used if the server supports it
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(message Message) error {
+	var auth smtp.Auth
+
+	// local stand-ins like mailpit don't need credentials
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{message.To}, format(m.From, message))
+
+	if err != nil {
+		return errors.New("unable to send mail: " + err.Error())
+	}
+
+	return nil
+}
+
+// LogMailer writes mails to a file or stdout instead of sending them, it is meant for local development
+type LogMailer struct {
+	File string
+	From string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content := format(m.From, message)
+
+	if m.File == "" {
+		fmt.Printf("Server: Mail:\n%s\n", content)
+		return nil
+	}
+
+	file, err := os.OpenFile(m.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+	if err != nil {
+		return errors.New("unable to open mail log: " + err.Error())
+	}
+
+	defer file.Close()
+
+	_, err = file.Write(append(content, '\n'))
+
+	if err != nil {
+		return errors.New("unable to write mail log: " + err.Error())
+	}
+
+	return nil
+}
+
+func format(from string, message Message) []byte {
+	// header values must not contain line breaks, otherwise headers could be injected
+	clean := strings.NewReplacer("\r", "", "\n", "")
+
+	headers := []string{
+		"From: " + clean.Replace(from),
+		"To: " + clean.Replace(message.To),
+		"Subject: " + clean.Replace(message.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + message.Body)
+}
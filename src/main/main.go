@@ -1,19 +1,32 @@
 package main
 
 import (
+	"backend/src/api"
 	"backend/src/db"
+	"backend/src/mail"
 	"backend/src/server"
+	"backend/src/utils"
+	"errors"
+	"io/fs"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/joho/godotenv"
 )
 
 func main() {
 
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+	/*
+		containers get their settings from the environment, only local development uses env files.
+		.env.local keeps secrets like JWT_SECRET out of the tracked .env, it is loaded first so its values win
+	*/
+	for _, envFile := range []string{".env.local", ".env"} {
+		err := godotenv.Load(envFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Fatalf("Error loading %s file: %v", envFile, err)
+		}
 	}
 
 	port_env := os.Getenv("BACKEND_PORT")
@@ -21,5 +34,40 @@ func main() {
 	port := server.CreateServer(":" + port_env)
 	db.ConnectDB()
 
-	server.Run(port)
+	err := api.LoadKeys()
+	if err != nil {
+		log.Fatalf("Error loading signing keys: %v", err)
+	}
+
+	api.SetMailer(mail.NewMailerFromEnv())
+
+	// new hashes use the configured algorithm, older hashes are upgraded at the next login
+	hasher, err := utils.PasswordHasherFromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring password hashing: %v", err)
+	}
+
+	db.SetPasswordHasher(hasher)
+
+	stores := db.NewStores()
+
+	// failed logins are kept in memory unless they should survive restarts or be shared by replicas
+	if os.Getenv("LOGIN_ATTEMPT_STORE") != "database" {
+		stores.Attempts = utils.NewMemoryAttemptStore()
+	}
+
+	// rotated keys are picked up without restart on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	go func() {
+		for range reload {
+			err := api.LoadKeys()
+			if err != nil {
+				log.Printf("Error reloading signing keys, keeping the old ones: %v", err)
+			}
+		}
+	}()
+
+	server.Run(port, stores)
 }
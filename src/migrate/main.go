@@ -0,0 +1,84 @@
+package main
+
+import (
+	"backend/src/db"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `usage: migrate <command>
+
+commands:
+  up          apply all pending migrations
+  down [n]    revert the last n migrations, 1 by default
+  status      list migrations and if they were applied`
+
+// migrate applies or reverts schema migrations without starting the server, e.g. as a deploy step
+func main() {
+
+	// the environment of a container is enough, .env is only needed for local development
+	err := godotenv.Load()
+	if err != nil && !os.IsNotExist(err) {
+		log.Fatalf("Error loading .env file: %v", err)
+	}
+
+	if len(os.Args) < 2 {
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "up":
+		db.Open()
+
+		applied, err := db.MigrateUp()
+		if err != nil {
+			log.Fatalf("Error migrating database: %v", err)
+		}
+
+		fmt.Printf("Applied %d migrations\n", len(applied))
+	case "down":
+		steps := 1
+
+		if len(os.Args) > 2 {
+			steps, err = strconv.Atoi(os.Args[2])
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of migrations: %s", os.Args[2])
+			}
+		}
+
+		db.Open()
+
+		reverted, err := db.MigrateDown(steps)
+		if err != nil {
+			log.Fatalf("Error reverting migrations: %v", err)
+		}
+
+		fmt.Printf("Reverted %d migrations\n", len(reverted))
+	case "status":
+		db.Open()
+
+		statuses, err := db.MigrationStatuses()
+		if err != nil {
+			log.Fatalf("Error reading migrations: %v", err)
+		}
+
+		for _, status := range statuses {
+			applied := "pending"
+
+			if status.Applied {
+				applied = "applied " + time.Unix(status.AppliedAt, 0).Format(time.RFC3339)
+			}
+
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+	default:
+		fmt.Println(usage)
+		os.Exit(2)
+	}
+}
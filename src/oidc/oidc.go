@@ -0,0 +1,426 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// unknown kids trigger a new download of the provider's keys, but not more often than this
+const keyRefreshInterval = time.Minute
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+/*
+ConfigFromEnv reads OIDC_ISSUER, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET, OIDC_REDIRECT_URL and OIDC_SCOPES.
+Without OIDC_ISSUER the login is disabled and nil is returned
+*/
+func ConfigFromEnv() (*Config, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+
+	if issuer == "" {
+		return nil, nil
+	}
+
+	config := &Config{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}
+
+	if config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required with OIDC_ISSUER")
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return config, nil
+}
+
+// Provider is an OpenID provider whose endpoints were read from its discovery document
+type Provider struct {
+	config                Config
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+	client                *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// IDClaims are the claims of the ID token the admin is mapped by
+type IDClaims struct {
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     Bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	AuthorizedParty   string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// Bool accepts true and "true", some providers send email_verified as string
+type Bool bool
+
+func (b *Bool) UnmarshalJSON(data []byte) error {
+	*b = Bool(strings.Trim(string(data), `"`) == "true")
+	return nil
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// Discover loads the discovery document of the issuer, its issuer has to match the configured one
+func Discover(config *Config) (*Provider, error) {
+	provider := &Provider{
+		config: *config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+
+	var document discoveryDocument
+
+	err := provider.getJSON(config.Issuer+"/.well-known/openid-configuration", &document)
+
+	if err != nil {
+		return nil, errors.New("oidc discovery failed: " + err.Error())
+	}
+
+	if strings.TrimSuffix(document.Issuer, "/") != config.Issuer {
+		return nil, errors.New("oidc discovery returned issuer " + document.Issuer + " instead of " + config.Issuer)
+	}
+
+	if document.AuthorizationEndpoint == "" || document.TokenEndpoint == "" || document.JWKSURI == "" {
+		return nil, errors.New("oidc discovery document is missing endpoints")
+	}
+
+	provider.authorizationEndpoint = document.AuthorizationEndpoint
+	provider.tokenEndpoint = document.TokenEndpoint
+	provider.jwksURI = document.JWKSURI
+
+	return provider, nil
+}
+
+// Issuer returns the issuer identities of this provider are stored with
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
+
+func (p *Provider) getJSON(address string, content any) error {
+	response, err := p.client.Get(address)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v answered with status %v", address, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(content)
+}
+
+// NewPKCE returns a code verifier and its S256 challenge (RFC 7636)
+func NewPKCE() (string, string, error) {
+	buffer := make([]byte, 32)
+
+	_, err := rand.Read(buffer)
+
+	if err != nil {
+		return "", "", errors.New("unable to generate code verifier: " + err.Error())
+	}
+
+	verifier := base64.RawURLEncoding.EncodeToString(buffer)
+	challenge := sha256.Sum256([]byte(verifier))
+
+	return verifier, base64.RawURLEncoding.EncodeToString(challenge[:]), nil
+}
+
+// AuthCodeURL returns the url of the provider's login page the browser is redirected to
+func (p *Provider) AuthCodeURL(state, nonce, challenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.authorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.authorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange redeems the authorization code at the token endpoint and returns the raw ID token
+func (p *Provider) Exchange(code, verifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("client_id", p.config.ClientID)
+	form.Set("code_verifier", verifier)
+
+	request, err := http.NewRequest(http.MethodPost, p.tokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	// public clients only authenticate with the code verifier
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	response, err := p.client.Do(request)
+
+	if err != nil {
+		return "", errors.New("token request failed: " + err.Error())
+	}
+
+	defer response.Body.Close()
+
+	var tokens tokenResponse
+
+	err = json.NewDecoder(response.Body).Decode(&tokens)
+
+	if err != nil {
+		return "", errors.New("invalid token response: " + err.Error())
+	}
+
+	if tokens.Error != "" {
+		return "", errors.New("token request failed: " + tokens.Error + " " + tokens.ErrorDescription)
+	}
+
+	if response.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return "", fmt.Errorf("token request failed with status %v", response.StatusCode)
+	}
+
+	return tokens.IDToken, nil
+}
+
+// VerifyIDToken checks signature, issuer, audience, lifetime and nonce of the ID token
+func (p *Provider) VerifyIDToken(rawToken, nonce string) (*IDClaims, error) {
+	var claims IDClaims
+
+	_, err := jwt.ParseWithClaims(rawToken, &claims, p.keyfunc,
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	if err != nil {
+		return nil, errors.New("invalid id token: " + err.Error())
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("id token nonce doesn't match")
+	}
+
+	// with several audiences the token has to be issued to us
+	if len(claims.Audience) > 1 {
+		if claims.AuthorizedParty != p.config.ClientID {
+			return nil, errors.New("id token was issued to another client")
+		}
+	}
+
+	return &claims, nil
+}
+
+// keyfunc selects the provider key by kid, keys are downloaded again when the provider rotated them
+func (p *Provider) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, exists := p.findKey(kid)
+
+	if !exists && time.Since(p.keysFetched) > keyRefreshInterval {
+		err := p.fetchKeys()
+
+		if err != nil {
+			return nil, err
+		}
+
+		key, exists = p.findKey(kid)
+	}
+
+	if !exists {
+		return nil, fmt.Errorf("unknown key: %v", kid)
+	}
+
+	return key, nil
+}
+
+// findKey returns the key with the kid, tokens without kid are accepted if the provider has a single key
+func (p *Provider) findKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+
+	key, exists := p.keys[kid]
+	return key, exists
+}
+
+func (p *Provider) fetchKeys() error {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	err := p.getJSON(p.jwksURI, &set)
+
+	if err != nil {
+		return errors.New("unable to load provider keys: " + err.Error())
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+
+		// keys of unsupported types are skipped, the provider may publish more than we need
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.KeyID] = key
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	return nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Curve != "P-256" {
+			return nil, errors.New("unsupported curve " + k.Curve)
+		}
+
+		x, err := decodeBigInt(k.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, errors.New("unsupported curve " + k.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, errors.New("unsupported key type " + k.KeyType)
+	}
+}
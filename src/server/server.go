@@ -2,8 +2,11 @@ package server
 
 import (
 	"backend/src/api"
+	"backend/src/store"
 	customTypes "backend/src/types"
+	"backend/src/utils"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -20,7 +23,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3001")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, xJwtToken, ID")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, xJwtToken, ID, X-CSRF-Token, X-Auth-Mode")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if r.Method == "OPTIONS" {
@@ -32,9 +35,59 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func Run(s *customTypes.Server) {
+/*
+Run serves the api on the address of the server.
+The stores are passed to the handlers, tests can use the memory stores instead of the database
+*/
+func Run(s *customTypes.Server, stores *store.Stores) {
+	router := NewRouter(stores)
+
+	fmt.Println("Server: Running and Listening on port: ", s.Adress)
+
+	serverhandler := &http.Server{
+		Addr:         s.Adress,
+		Handler:      router,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		IdleTimeout:  15 * time.Second,
+	}
+
+	err := serverhandler.ListenAndServe()
+
+	if err != nil {
+		fmt.Printf("Server: Error running server: %v\n", err)
+	}
+}
+
+// NewRouter registers every route, the handlers only read and write the given stores
+func NewRouter(stores *store.Stores) *mux.Router {
+	handlers := api.New(stores)
+
 	router := mux.NewRouter()
 
+	// dashboard routes are guarded by the permissions of the admin's roles
+	canReadUsers := handlers.RequirePermission(customTypes.PermUsersRead)
+	canWriteUsers := handlers.RequirePermission(customTypes.PermUsersWrite)
+	canReadAdmins := handlers.RequirePermission(customTypes.PermAdminsRead)
+	canWriteAdmins := handlers.RequirePermission(customTypes.PermAdminsWrite)
+	canReadDocker := handlers.RequirePermission(customTypes.PermDockerRead)
+	canImpersonate := handlers.RequirePermission(customTypes.PermUsersImpersonate)
+
+	// routes acting on a single record: users and admins may access their own, others need the permission
+	selfOr := handlers.RequireSelfOrPermission
+
+	// account changes an admin must not make while impersonating the user
+	noImpersonation := api.DenyImpersonation
+
+	// forwarding headers are only trusted from the proxies in TRUSTED_PROXIES
+	resolver, err := utils.IPResolverFromEnv()
+	if err != nil {
+		log.Fatal("Server: Invalid trusted proxies: ", err.Error())
+	}
+
+	router.Use(api.ClientIPMiddleware(resolver))
+	router.Use(api.AccessLog)
+
 	// use CORS middleware to allow cross domain requests, fix later whith nginx oder some other shit
 	router.Use(corsMiddleware)
 
@@ -46,53 +99,99 @@ func Run(s *customTypes.Server) {
 
 	*/
 	router.HandleFunc("/bier", api.HandleError(api.HandleGetBier)).Methods("GET", "OPTIONS")
-	router.HandleFunc("/register", api.HandleError(api.HandleRegisterUser)).Methods("POST", "OPTIONS")
-	router.HandleFunc("/login", api.HandleError(api.HandleLoginUser)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/.well-known/jwks.json", api.HandleError(api.HandleGetJWKS)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/register", api.HandleError(handlers.HandleRegisterUser)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/login", api.HandleError(handlers.HandleLoginUser)).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/login/magic", api.HandleError(handlers.HandleRequestMagicLink)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/login/magic/verify", api.HandleError(handlers.HandleVerifyMagicLink)).Methods("GET", "POST", "OPTIONS")
+
+	router.HandleFunc("/token/refresh", api.HandleError(handlers.HandleRefreshToken)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/logout", api.HandleError(handlers.HandleLogout)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/logout/all", handlers.JWTAuth(noImpersonation(api.HandleError(handlers.HandleLogoutEverywhere)))).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/sessions", handlers.JWTAuth(api.HandleError(handlers.HandleGetSessions))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/sessions/{id}", handlers.JWTAuth(noImpersonation(api.HandleError(handlers.HandleDeleteSession)))).Methods("DELETE", "OPTIONS")
+
+	router.HandleFunc("/password/forgot", api.HandleError(handlers.HandleForgotPassword)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/password/reset", api.HandleError(handlers.HandleResetPassword)).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/verify-email", api.HandleError(handlers.HandleVerifyEmail)).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/verify-email/resend", handlers.JWTAuth(api.RequireRole(customTypes.RoleUser)(api.HandleError(handlers.HandleResendVerification)))).Methods("POST", "OPTIONS")
 
 	/*
 		guarded api routes
 	*/
 
-	router.HandleFunc("/user/{ID}", api.JWTAuth(api.HandleError(api.HandleGetUserByID))).Methods("GET", "OPTIONS")
-	router.HandleFunc("/users", api.JWTAuth(api.HandleError(api.HandleGetMultibleUsers))).Methods("GET", "OPTIONS")
-	router.HandleFunc("/user/search", api.JWTAuth(api.HandleError(api.HandleSearchUsers))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/user/{ID}", handlers.JWTAuth(selfOr(customTypes.USER, customTypes.PermUsersRead)(api.HandleError(handlers.HandleGetUserByID)))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/users", handlers.JWTAuth(canReadUsers(api.HandleError(handlers.HandleGetMultibleUsers)))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/user/search", handlers.JWTAuth(canReadUsers(api.HandleError(handlers.HandleSearchUsers)))).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/user/edit/{ID}", handlers.JWTAuth(noImpersonation(selfOr(customTypes.USER, customTypes.PermUsersWrite)(api.HandleError(handlers.HandleEditUser))))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/user/delete/{ID}", handlers.JWTAuth(noImpersonation(selfOr(customTypes.USER, customTypes.PermUsersDelete)(api.HandleError(handlers.HandleDeleteUser))))).Methods("POST", "OPTIONS")
+
+	// a login with a forced password change only gets a token for these routes
+	passwordChange := handlers.TokenAuth(api.PurposeAccess, api.PurposePasswordChange)
 
-	router.HandleFunc("/user/edit/{ID}", api.JWTAuth(api.HandleError(api.HandleEditUser))).Methods("POST", "OPTIONS")
-	router.HandleFunc("/user/delete/{ID}", api.JWTAuth(api.HandleError(api.HandleDeleteUser))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/user/{ID}/password", passwordChange(noImpersonation(api.RequireSelf(customTypes.USER)(api.HandleError(handlers.HandleChangeUserPassword))))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/user/{ID}/login-methods", handlers.JWTAuth(noImpersonation(selfOr(customTypes.USER, customTypes.PermUsersWrite)(api.HandleError(handlers.HandleSetLoginMethods))))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/user/{ID}/password/expire", handlers.JWTAuth(canWriteUsers(api.HandleError(handlers.HandleExpireUserPassword)))).Methods("POST", "OPTIONS")
 
 	/*
 		admin routes for dashboard
 	*/
 
-	router.HandleFunc("/admin/login", api.HandleError(api.HandleLoginAdmin)).Methods("POST", "OPTIONS")
-	router.HandleFunc("/admin/validateJWT", api.HandleError(api.HandleValidateAdminJWT)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/login", api.HandleError(handlers.HandleLoginAdmin)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/oidc/login", api.HandleError(api.HandleOIDCLogin)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/oidc/callback", api.HandleError(handlers.HandleOIDCCallback)).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/admin/validateJWT", api.HandleError(handlers.HandleValidateAdminJWT)).Methods("POST", "OPTIONS")
+
+	/*
+		second login step of admins with mfa, guarded by the mfa token of the login.
+		enrollment accepts it as well, so admins can enroll at login when mfa is required
+	*/
+	mfaLogin := handlers.TokenAuth(api.PurposeMFA)
+	mfaEnrollment := handlers.TokenAuth(api.PurposeAccess, api.PurposeMFA)
+	adminOnly := api.RequireRole(customTypes.RoleAdmin)
+
+	router.HandleFunc("/admin/login/mfa", mfaLogin(api.HandleError(handlers.HandleLoginAdminMFA))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/mfa/enroll", mfaEnrollment(adminOnly(api.HandleError(handlers.HandleEnrollMFA)))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/mfa/confirm", mfaEnrollment(adminOnly(api.HandleError(handlers.HandleConfirmMFA)))).Methods("POST", "OPTIONS")
 
 	/*
 		guarded admin api routes
 	*/
 
-	router.HandleFunc("/admin/{ID}", api.JWTAuth(api.HandleError(api.HandleGetAdminByID))).Methods("GET", "OPTIONS")
-	router.HandleFunc("/admins", api.JWTAuth(api.HandleError(api.HandleGetMultibleAdmins))).Methods("GET", "OPTIONS")
+	// registered before /admin/{ID}, otherwise e.g. "lockouts" would be taken as ID
+	router.HandleFunc("/admin/lockouts", handlers.JWTAuth(canReadAdmins(api.HandleError(handlers.HandleGetLockouts)))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/lockouts/{key}", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleDeleteLockout)))).Methods("DELETE", "OPTIONS")
 
-	router.HandleFunc("/admin/edit/{ID}", api.JWTAuth(api.HandleError(api.HandleEditAdmin))).Methods("POST", "OPTIONS")
-	router.HandleFunc("/admin/delete/{ID}", api.JWTAuth(api.HandleError(api.HandleDeleteAdmin))).Methods("POST", "OPTIONS")
-	router.HandleFunc("/admin/add", api.JWTAuth(api.HandleError(api.HandleAddAdmin))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/audit-log", handlers.JWTAuth(canReadAdmins(api.HandleError(handlers.HandleGetAuditLog)))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/impersonate/{userID}", handlers.JWTAuth(adminOnly(canImpersonate(api.HandleError(handlers.HandleImpersonateUser))))).Methods("POST", "OPTIONS")
 
-	router.HandleFunc("/docker/containers", api.JWTAuth(api.HandleError(api.HandleGetDockerContainers))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/apikeys", handlers.JWTAuth(canReadAdmins(api.HandleError(handlers.HandleGetApiKeys)))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/apikeys", handlers.JWTAuth(adminOnly(canWriteAdmins(api.HandleError(handlers.HandleCreateApiKey))))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/apikeys/{id}", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleRevokeApiKey)))).Methods("DELETE", "OPTIONS")
 
-	fmt.Println("Server: Running and Listening on port: ", s.Adress)
+	router.HandleFunc("/admin/{ID}", handlers.JWTAuth(selfOr(customTypes.ADMIN, customTypes.PermAdminsRead)(api.HandleError(handlers.HandleGetAdminByID)))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admins", handlers.JWTAuth(canReadAdmins(api.HandleError(handlers.HandleGetMultibleAdmins)))).Methods("GET", "OPTIONS")
 
-	serverhandler := &http.Server{
-		Addr:         s.Adress,
-		Handler:      router,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-		IdleTimeout:  15 * time.Second,
-	}
+	router.HandleFunc("/admin/edit/{ID}", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleEditAdmin)))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/delete/{ID}", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleDeleteAdmin)))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/add", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleAddAdmin)))).Methods("POST", "OPTIONS")
 
-	err := serverhandler.ListenAndServe()
+	router.HandleFunc("/roles", handlers.JWTAuth(canReadAdmins(api.HandleError(handlers.HandleGetRoles)))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/roles/{ID}", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleSetAdminRoles)))).Methods("POST", "OPTIONS")
 
-	if err != nil {
-		fmt.Printf("Server: Error running server: %v\n", err)
-	}
+	router.HandleFunc("/admin/{ID}/password", passwordChange(api.RequireSelf(customTypes.ADMIN)(api.HandleError(handlers.HandleChangeAdminPassword)))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/{ID}/password/expire", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleExpireAdminPassword)))).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/admin/mfa/disable", handlers.JWTAuth(adminOnly(api.HandleError(handlers.HandleDisableMFA)))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/mfa/reset/{ID}", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleResetAdminMFA)))).Methods("POST", "OPTIONS")
+	router.HandleFunc("/admin/mfa/policy", handlers.JWTAuth(canReadAdmins(api.HandleError(handlers.HandleGetMFAPolicy)))).Methods("GET", "OPTIONS")
+	router.HandleFunc("/admin/mfa/policy", handlers.JWTAuth(canWriteAdmins(api.HandleError(handlers.HandleSetMFAPolicy)))).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/docker/containers", handlers.JWTAuth(canReadDocker(api.HandleError(api.HandleGetDockerContainers)))).Methods("GET", "OPTIONS")
+
+	return router
 }
@@ -0,0 +1,766 @@
+package server
+
+import (
+	"backend/src/api"
+	"backend/src/mail"
+	"backend/src/store"
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// testPassword satisfies the default password policy
+const testPassword = "Correct-Horse-7"
+
+// newTestServer serves the router with the memory stores, no database is needed. Tests seed admins through the stores
+func newTestServer(t *testing.T) (*httptest.Server, *store.Stores) {
+	t.Helper()
+
+	t.Setenv("JWT_SECRET", "test-secret-which-is-only-used-by-these-tests")
+	t.Setenv("JWT_KEYS_DIR", "")
+	t.Setenv("COOKIE_AUTH", "false")
+	t.Setenv("REQUIRE_EMAIL_VERIFICATION", "false")
+
+	err := api.LoadKeys()
+	if err != nil {
+		t.Fatalf("loading keys: %v", err)
+	}
+
+	stores := store.NewMemoryStores(&utils.BcryptHasher{Cost: 4})
+
+	server := httptest.NewServer(NewRouter(stores))
+	t.Cleanup(server.Close)
+
+	return server, stores
+}
+
+// testMailer keeps the sent mails instead of sending them, with err set every mail fails
+type testMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+	err      error
+}
+
+func (m *testMailer) Send(message mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return m.err
+	}
+
+	m.messages = append(m.messages, message)
+
+	return nil
+}
+
+func useTestMailer(t *testing.T) *testMailer {
+	t.Helper()
+
+	mailer := &testMailer{}
+	api.SetMailer(mailer)
+	t.Cleanup(func() { api.SetMailer(&mail.LogMailer{}) })
+
+	return mailer
+}
+
+// linkToken returns the token of the link in the last mail sent to the address
+func (m *testMailer) linkToken(t *testing.T, to string) string {
+	t.Helper()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.messages) - 1; i >= 0; i-- {
+		if m.messages[i].To != to {
+			continue
+		}
+
+		for _, field := range strings.Fields(m.messages[i].Body) {
+			link, err := url.Parse(field)
+
+			if err == nil && link.Query().Get("token") != "" {
+				return link.Query().Get("token")
+			}
+		}
+	}
+
+	t.Fatalf("no link was mailed to %s", to)
+	return ""
+}
+
+// do sends the request and decodes the json response into result
+func do(t *testing.T, method, url, token string, body any, result any) int {
+	t.Helper()
+
+	var payload bytes.Buffer
+
+	if body != nil {
+		err := json.NewEncoder(&payload).Encode(body)
+		if err != nil {
+			t.Fatalf("encoding request: %v", err)
+		}
+	}
+
+	request, err := http.NewRequest(method, url, &payload)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	if token != "" {
+		request.Header.Set("xJwtToken", token)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+
+	defer response.Body.Close()
+
+	if result != nil {
+		err = json.NewDecoder(response.Body).Decode(result)
+		if err != nil {
+			t.Fatalf("decoding response of %s %s: %v", method, url, err)
+		}
+	}
+
+	return response.StatusCode
+}
+
+// registerAndLogin registers the user and returns the ID and tokens of it
+func registerAndLogin(t *testing.T, baseURL, email string) (string, customTypes.TokenPair) {
+	t.Helper()
+
+	status := do(t, "POST", baseURL+"/register", "", customTypes.RegisterUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: email, Password: testPassword}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("register %s: got status %d", email, status)
+	}
+
+	var login map[string]any
+
+	status = do(t, "POST", baseURL+"/login", "", customTypes.LoginUserRequest{Email: email, Password: testPassword}, &login)
+	if status != http.StatusOK {
+		t.Fatalf("login %s: got status %d", email, status)
+	}
+
+	tokens := customTypes.TokenPair{}
+	tokens.AccessToken, _ = login["X-JWT-Token"].(string)
+	tokens.RefreshToken, _ = login["refreshToken"].(string)
+
+	claims, err := api.ValidateJWT(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("access token of %s: %v", email, err)
+	}
+
+	return claims.Subject, tokens
+}
+
+func TestRegisterLoginGetUser(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	userID, tokens := registerAndLogin(t, server.URL, " Ada@Example.com ")
+	otherID, otherTokens := registerAndLogin(t, server.URL, "grace@example.com")
+	token, otherToken := tokens.AccessToken, otherTokens.AccessToken
+
+	tests := []struct {
+		name   string
+		id     string
+		token  string
+		status int
+	}{
+		{name: "own record", id: userID, token: token, status: http.StatusOK},
+		{name: "record of another user", id: otherID, token: token, status: http.StatusForbidden},
+		{name: "other user reads own record", id: otherID, token: otherToken, status: http.StatusOK},
+		{name: "without token", id: userID, status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var usr customTypes.User
+
+			status := do(t, "GET", server.URL+"/user/"+test.id, test.token, nil, &usr)
+
+			if status != test.status {
+				t.Fatalf("got status %d, want %d", status, test.status)
+			}
+
+			if status == http.StatusOK && usr.ID.String() != test.id {
+				t.Errorf("got user %s, want %s", usr.ID, test.id)
+			}
+		})
+	}
+
+	var usr customTypes.User
+
+	do(t, "GET", server.URL+"/user/"+userID, token, nil, &usr)
+
+	if usr.Email != "ada@example.com" || usr.FirstName != "Ada" || usr.EmailVerified {
+		t.Errorf("got user %+v, want the normalized, unverified email of the registration", usr)
+	}
+}
+
+// a refresh token used a second time ends the session, the legitimate client and the thief both lose it
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	userID, first := registerAndLogin(t, server.URL, "ada@example.com")
+
+	var second customTypes.TokenPair
+
+	status := do(t, "POST", server.URL+"/token/refresh", "", customTypes.RefreshTokenRequest{RefreshToken: first.RefreshToken}, &second)
+	if status != http.StatusOK || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("first rotation: got status %d and tokens %+v, want new tokens", status, second)
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+	}{
+		{name: "rotated access token works", method: "GET", path: "/user/" + userID, token: second.AccessToken, status: http.StatusOK},
+		{name: "used refresh token is reused", method: "POST", path: "/token/refresh", body: customTypes.RefreshTokenRequest{RefreshToken: first.RefreshToken}, status: http.StatusUnauthorized},
+		{name: "newest refresh token of the session", method: "POST", path: "/token/refresh", body: customTypes.RefreshTokenRequest{RefreshToken: second.RefreshToken}, status: http.StatusUnauthorized},
+		{name: "access token of the session", method: "GET", path: "/user/" + userID, token: second.AccessToken, status: http.StatusUnauthorized},
+		{name: "unknown refresh token", method: "POST", path: "/token/refresh", body: customTypes.RefreshTokenRequest{RefreshToken: "unknown"}, status: http.StatusUnauthorized},
+	}
+
+	for _, step := range steps {
+		var response map[string]any
+
+		status := do(t, step.method, server.URL+step.path, step.token, step.body, &response)
+
+		if status != step.status {
+			t.Errorf("%s: got status %d %v, want %d", step.name, status, response, step.status)
+		}
+	}
+
+	// other logins of the user are not affected
+	var login map[string]any
+
+	status = do(t, "POST", server.URL+"/login", "", customTypes.LoginUserRequest{Email: "ada@example.com", Password: testPassword}, &login)
+	if status != http.StatusOK {
+		t.Fatalf("second login: got status %d", status)
+	}
+
+	refreshToken, _ := login["refreshToken"].(string)
+
+	status = do(t, "POST", server.URL+"/token/refresh", "", customTypes.RefreshTokenRequest{RefreshToken: refreshToken}, nil)
+	if status != http.StatusOK {
+		t.Errorf("refresh of another session: got status %d, want 200", status)
+	}
+}
+
+// deleting an account ends its sessions, neither the access token nor the refresh token of it work afterwards
+func TestDeletedUserLosesSessions(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	userID, tokens := registerAndLogin(t, server.URL, "ada@example.com")
+
+	status := do(t, "POST", server.URL+"/user/delete/"+userID, tokens.AccessToken, nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("delete: got status %d, want 200", status)
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+	}{
+		{name: "access token", method: "GET", path: "/user/" + userID, token: tokens.AccessToken},
+		{name: "refresh token", method: "POST", path: "/token/refresh", body: customTypes.RefreshTokenRequest{RefreshToken: tokens.RefreshToken}},
+	}
+
+	for _, step := range steps {
+		var response map[string]any
+
+		status := do(t, step.method, server.URL+step.path, step.token, step.body, &response)
+
+		if status != http.StatusUnauthorized {
+			t.Errorf("%s: got status %d %v, want 401", step.name, status, response)
+		}
+	}
+}
+
+// the dashboard asks whether a token belongs to a logged in admin, only access tokens of active admin sessions do
+func TestValidateAdminJWT(t *testing.T) {
+	server, stores := newTestServer(t)
+
+	adm, err := stores.Admins.Add(context.Background(), &customTypes.AddAdminRequest{UserName: "Julian", Email: "julian@example.com", Password: testPassword, Roles: []string{customTypes.RoleSuperadmin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adminID := adm.ID.String()
+
+	login := func() string {
+		var response map[string]any
+
+		status := do(t, "POST", server.URL+"/admin/login", "", customTypes.LoginAdminRequest{Email: "julian@example.com", Password: testPassword}, &response)
+		if status != http.StatusOK {
+			t.Fatalf("admin login: got status %d %v", status, response)
+		}
+
+		token, _ := response["xJwtToken"].(string)
+
+		return token
+	}
+
+	accessToken := login()
+	loggedOut := login()
+
+	status := do(t, "POST", server.URL+"/logout", loggedOut, nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("logout: got status %d", status)
+	}
+
+	mfaToken, err := api.IssuePurposeToken(adminID, customTypes.ADMIN, api.PurposeMFA, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwordChangeToken, err := api.IssuePurposeToken(adminID, customTypes.ADMIN, api.PurposePasswordChange, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userID, userTokens := registerAndLogin(t, server.URL, "ada@example.com")
+
+	tests := []struct {
+		name   string
+		token  string
+		id     string
+		status int
+	}{
+		{name: "access token", token: accessToken, id: adminID, status: http.StatusOK},
+		{name: "id of another admin", token: accessToken, id: userID, status: http.StatusForbidden},
+		{name: "mfa token", token: mfaToken, id: adminID, status: http.StatusForbidden},
+		{name: "password change token", token: passwordChangeToken, id: adminID, status: http.StatusForbidden},
+		{name: "logged out", token: loggedOut, id: adminID, status: http.StatusForbidden},
+		{name: "user token", token: userTokens.AccessToken, id: userID, status: http.StatusForbidden},
+		{name: "invalid token", token: "invalid", id: adminID, status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := do(t, "POST", server.URL+"/admin/validateJWT", "", customTypes.ValidateJWTRequest{Token: test.token, ID: test.id}, nil)
+
+			if status != test.status {
+				t.Errorf("got status %d, want %d", status, test.status)
+			}
+		})
+	}
+}
+
+// anybody can request login links for any email, that must not block the password login of the account
+func TestMagicLinkRequestsKeepPasswordLogin(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_MAX_ATTEMPTS_PER_IP", "100")
+
+	server, _ := newTestServer(t)
+
+	registerAndLogin(t, server.URL, "ada@example.com")
+
+	status := 0
+
+	for i := 0; i < 5 && status != http.StatusTooManyRequests; i++ {
+		status = do(t, "POST", server.URL+"/login/magic", "", customTypes.MagicLinkRequest{Email: "ada@example.com"}, nil)
+	}
+
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("link requests: got status %d, want them to be throttled", status)
+	}
+
+	status = do(t, "POST", server.URL+"/login", "", customTypes.LoginUserRequest{Email: "ada@example.com", Password: testPassword}, nil)
+	if status != http.StatusOK {
+		t.Errorf("password login: got status %d, want 200", status)
+	}
+}
+
+// a failing mail must not tell the caller that the account exists
+func TestMagicLinkRequestHidesFailures(t *testing.T) {
+	server, _ := newTestServer(t)
+	mailer := useTestMailer(t)
+
+	registerAndLogin(t, server.URL, "ada@example.com")
+
+	mailer.err = errors.New("smtp server unreachable")
+
+	for _, email := range []string{"ada@example.com", "grace@example.com"} {
+		var response map[string]string
+
+		status := do(t, "POST", server.URL+"/login/magic", "", customTypes.MagicLinkRequest{Email: email}, &response)
+
+		if status != http.StatusOK || response["message"] != "if the account exists, a login link was sent" {
+			t.Errorf("%s: got status %d %v, want the generic response", email, status, response)
+		}
+	}
+}
+
+// a login link only works for the address the account has when it is opened
+func TestMagicLinkAfterEmailChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		newEmail string
+		status   int
+	}{
+		{name: "email unchanged", status: http.StatusOK},
+		{name: "email changed in case only", newEmail: "ADA@example.com", status: http.StatusOK},
+		{name: "email changed", newEmail: "ada@lovelace.org", status: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, _ := newTestServer(t)
+			mailer := useTestMailer(t)
+
+			userID, tokens := registerAndLogin(t, server.URL, "ada@example.com")
+
+			status := do(t, "POST", server.URL+"/login/magic", "", customTypes.MagicLinkRequest{Email: "ada@example.com"}, nil)
+			if status != http.StatusOK {
+				t.Fatalf("link request: got status %d", status)
+			}
+
+			token := mailer.linkToken(t, "ada@example.com")
+
+			if test.newEmail != "" {
+				status = do(t, "POST", server.URL+"/user/edit/"+userID, tokens.AccessToken, customTypes.EditUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: test.newEmail}, nil)
+				if status != http.StatusOK {
+					t.Fatalf("edit: got status %d", status)
+				}
+			}
+
+			var response map[string]any
+
+			status = do(t, "POST", server.URL+"/login/magic/verify", "", customTypes.MagicLinkVerifyRequest{Token: token}, &response)
+
+			if status != test.status {
+				t.Errorf("got status %d %v, want %d", status, response, test.status)
+			}
+		})
+	}
+}
+
+// mockOIDCProvider is an identity provider with discovery, JWKS and token endpoint, its login page signs in at once
+type mockOIDCProvider struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu sync.Mutex
+	// codes are the issued authorization codes with the login they belong to
+	codes map[string]mockAuthorization
+	// subject and email are who signs in at the provider, claims changes the ID token before it is signed
+	subject string
+	email   string
+	claims  func(claims jwt.MapClaims)
+}
+
+type mockAuthorization struct {
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+func newMockOIDCProvider(t *testing.T, clientID string) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &mockOIDCProvider{key: key, clientID: clientID, codes: make(map[string]mockAuthorization)}
+
+	router := http.NewServeMux()
+	router.HandleFunc("/.well-known/openid-configuration", provider.handleDiscovery)
+	router.HandleFunc("/jwks", provider.handleJWKS)
+	router.HandleFunc("/authorize", provider.handleAuthorize)
+	router.HandleFunc("/token", provider.handleToken)
+
+	provider.Server = httptest.NewServer(router)
+	t.Cleanup(provider.Close)
+
+	return provider
+}
+
+func (p *mockOIDCProvider) handleDiscovery(writer http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(writer).Encode(map[string]string{
+		"issuer":                 p.URL,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *mockOIDCProvider) handleJWKS(writer http.ResponseWriter, _ *http.Request) {
+	json.NewEncoder(writer).Encode(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "mock",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+	}}})
+}
+
+// handleAuthorize signs the user in without a login page and redirects back with a code
+func (p *mockOIDCProvider) handleAuthorize(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	if query.Get("response_type") != "code" || query.Get("client_id") != p.clientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(writer, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code, err := utils.GenerateToken(16)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	p.mu.Lock()
+	p.codes[code] = mockAuthorization{nonce: query.Get("nonce"), challenge: query.Get("code_challenge"), redirectURI: query.Get("redirect_uri")}
+	p.mu.Unlock()
+
+	http.Redirect(writer, request, query.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {query.Get("state")}}.Encode(), http.StatusFound)
+}
+
+// handleToken redeems a code once, the code verifier has to match the challenge of the login (PKCE)
+func (p *mockOIDCProvider) handleToken(writer http.ResponseWriter, request *http.Request) {
+	err := request.ParseForm()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	authorization, exists := p.codes[request.PostForm.Get("code")]
+	delete(p.codes, request.PostForm.Get("code"))
+
+	challenge := sha256.Sum256([]byte(request.PostForm.Get("code_verifier")))
+
+	if !exists || request.PostForm.Get("client_id") != p.clientID || request.PostForm.Get("redirect_uri") != authorization.redirectURI || base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.challenge {
+		writer.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(writer).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            p.clientID,
+		"sub":            p.subject,
+		"email":          p.email,
+		"email_verified": true,
+		"nonce":          authorization.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+	}
+
+	if p.claims != nil {
+		p.claims(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock"
+
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(writer).Encode(map[string]string{"id_token": idToken})
+}
+
+// newOIDCTestServer configures the backend for the mock provider, the state cookie is sent over plain http
+func newOIDCTestServer(t *testing.T) (*httptest.Server, *store.Stores, *mockOIDCProvider) {
+	t.Helper()
+
+	t.Setenv("COOKIE_SECURE", "false")
+	t.Setenv("OIDC_JIT_PROVISIONING", "false")
+
+	server, stores := newTestServer(t)
+	provider := newMockOIDCProvider(t, "backend")
+
+	t.Setenv("OIDC_ISSUER", provider.URL)
+	t.Setenv("OIDC_CLIENT_ID", "backend")
+	t.Setenv("OIDC_CLIENT_SECRET", "")
+	t.Setenv("OIDC_REDIRECT_URL", server.URL+"/admin/oidc/callback")
+	t.Setenv("OIDC_SCOPES", "")
+
+	return server, stores, provider
+}
+
+// oidcLogin follows the redirects of a provider login by hand, tamper may change the callback the provider sends back
+func oidcLogin(t *testing.T, baseURL string, tamper func(query url.Values)) (int, map[string]any) {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{Jar: jar, CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	redirect := func(address string) *url.URL {
+		t.Helper()
+
+		response, err := client.Get(address)
+		if err != nil {
+			t.Fatalf("GET %s: %v", address, err)
+		}
+
+		response.Body.Close()
+
+		location, err := response.Location()
+		if err != nil {
+			t.Fatalf("GET %s: got status %d, want a redirect", address, response.StatusCode)
+		}
+
+		return location
+	}
+
+	authorize := redirect(baseURL + "/admin/oidc/login")
+	callback := redirect(authorize.String())
+
+	if tamper != nil {
+		query := callback.Query()
+		tamper(query)
+		callback.RawQuery = query.Encode()
+	}
+
+	response, err := client.Get(callback.String())
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+
+	defer response.Body.Close()
+
+	var result map[string]any
+
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		t.Fatalf("decoding callback response: %v", err)
+	}
+
+	return response.StatusCode, result
+}
+
+func TestOIDCLogin(t *testing.T) {
+	tests := []struct {
+		name string
+		// email is the address at the provider, the admin has julian@example.com
+		email  string
+		claims func(claims jwt.MapClaims)
+		tamper func(query url.Values)
+		status int
+	}{
+		{name: "verified email of an admin", email: "julian@example.com", status: http.StatusOK},
+		{name: "email differing in case", email: "Julian@Example.com", status: http.StatusOK},
+		{name: "state mismatch", email: "julian@example.com", tamper: func(query url.Values) { query.Set("state", "forged") }, status: http.StatusUnauthorized},
+		{name: "missing state", email: "julian@example.com", tamper: func(query url.Values) { query.Del("state") }, status: http.StatusUnauthorized},
+		{name: "nonce of another login", email: "julian@example.com", claims: func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }, status: http.StatusUnauthorized},
+		{name: "other issuer", email: "julian@example.com", claims: func(claims jwt.MapClaims) { claims["iss"] = "https://idp.example.com" }, status: http.StatusUnauthorized},
+		{name: "other audience", email: "julian@example.com", claims: func(claims jwt.MapClaims) { claims["aud"] = "other-client" }, status: http.StatusUnauthorized},
+		{name: "expired id token", email: "julian@example.com", claims: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() }, status: http.StatusUnauthorized},
+		{name: "unverified email", email: "julian@example.com", claims: func(claims jwt.MapClaims) { claims["email_verified"] = false }, status: http.StatusForbidden},
+		{name: "unknown email", email: "mallory@example.com", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, stores, provider := newOIDCTestServer(t)
+
+			adm, err := stores.Admins.Add(context.Background(), &customTypes.AddAdminRequest{UserName: "Julian", Email: "julian@example.com", Password: testPassword, Roles: []string{customTypes.RoleOps}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			provider.subject = "provider-subject"
+			provider.email = test.email
+			provider.claims = test.claims
+
+			status, response := oidcLogin(t, server.URL, test.tamper)
+
+			if status != test.status {
+				t.Fatalf("got status %d %v, want %d", status, response, test.status)
+			}
+
+			if status != http.StatusOK {
+				return
+			}
+
+			token, _ := response["xJwtToken"].(string)
+
+			claims, err := api.ValidateJWT(token)
+			if err != nil || claims.Subject != adm.ID.String() || claims.SubjectType != customTypes.ADMIN {
+				t.Errorf("got token %+v %v, want an access token of admin %s", claims, err, adm.ID)
+			}
+		})
+	}
+}
+
+// the first login links the identity by email, later logins find the admin by the subject even if the email changed
+func TestOIDCLoginLinksIdentity(t *testing.T) {
+	server, stores, provider := newOIDCTestServer(t)
+
+	adm, err := stores.Admins.Add(context.Background(), &customTypes.AddAdminRequest{UserName: "Julian", Email: "julian@example.com", Password: testPassword, Roles: []string{customTypes.RoleOps}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		subject string
+		email   string
+		status  int
+	}{
+		{name: "first login links the identity", subject: "provider-subject", email: "julian@example.com", status: http.StatusOK},
+		{name: "email changed at the provider", subject: "provider-subject", email: "julian@company.example", status: http.StatusOK},
+		{name: "other identity with an unknown email", subject: "other-subject", email: "julian@company.example", status: http.StatusForbidden},
+	}
+
+	for _, step := range steps {
+		provider.subject = step.subject
+		provider.email = step.email
+
+		status, response := oidcLogin(t, server.URL, nil)
+
+		if status != step.status {
+			t.Fatalf("%s: got status %d %v, want %d", step.name, status, response, step.status)
+		}
+
+		if status == http.StatusOK && response["adminId"] != adm.ID.String() {
+			t.Errorf("%s: got admin %v, want %s", step.name, response["adminId"], adm.ID)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ApiKeyStore keeps the hashes of the api keys, the keys themselves are never stored
+type ApiKeyStore interface {
+	Create(ctx context.Context, key *customTypes.ApiKey) error
+	GetByPrefix(ctx context.Context, prefix string) (*customTypes.ApiKey, error)
+	// List returns every key, the newest first
+	List(ctx context.Context) (*[]customTypes.ApiKey, error)
+	// Revoke reports false if no key with the ID exists
+	Revoke(ctx context.Context, keyID string) (bool, error)
+	// Touch updates LastUsed, at most once per minute so not every request writes
+	Touch(ctx context.Context, keyID string, now time.Time) error
+}
+
+type MemoryApiKeyStore struct {
+	mu   sync.Mutex
+	keys []*customTypes.ApiKey
+}
+
+func NewMemoryApiKeyStore() *MemoryApiKeyStore {
+	return &MemoryApiKeyStore{}
+}
+
+// copyApiKey prevents callers from changing stored keys
+func copyApiKey(key *customTypes.ApiKey) *customTypes.ApiKey {
+	copied := *key
+	copied.Scopes = append([]string{}, key.Scopes...)
+
+	return &copied
+}
+
+func (s *MemoryApiKeyStore) Create(_ context.Context, key *customTypes.ApiKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.keys {
+		if existing.ID == key.ID || existing.Prefix == key.Prefix {
+			return errors.New("couldn't store api key: duplicate key")
+		}
+	}
+
+	stored := copyApiKey(key)
+	stored.LastUsed = 0
+	stored.Revoked = false
+	s.keys = append(s.keys, stored)
+
+	return nil
+}
+
+func (s *MemoryApiKeyStore) GetByPrefix(_ context.Context, prefix string) (*customTypes.ApiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.Prefix == prefix {
+			return copyApiKey(key), nil
+		}
+	}
+
+	return nil, errors.New("api key not found")
+}
+
+func (s *MemoryApiKeyStore) List(_ context.Context) (*[]customTypes.ApiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyList := []customTypes.ApiKey{}
+
+	for _, key := range s.keys {
+		keyList = append(keyList, *copyApiKey(key))
+	}
+
+	slices.SortStableFunc(keyList, func(a, b customTypes.ApiKey) int { return cmp.Compare(b.Created, a.Created) })
+
+	return &keyList, nil
+}
+
+func (s *MemoryApiKeyStore) Revoke(_ context.Context, keyID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.ID == keyID {
+			key.Revoked = true
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *MemoryApiKeyStore) Touch(_ context.Context, keyID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.keys {
+		if key.ID == keyID && key.LastUsed < now.Add(-time.Minute).Unix() {
+			key.LastUsed = now.Unix()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"sync"
+)
+
+// AuditStore records what admins did in the name of users
+type AuditStore interface {
+	Add(ctx context.Context, entry *customTypes.AuditEntry) error
+	// List returns the newest entries first
+	List(ctx context.Context, quantity int) (*[]customTypes.AuditEntry, error)
+}
+
+type MemoryAuditStore struct {
+	mu      sync.Mutex
+	entries []customTypes.AuditEntry
+}
+
+func NewMemoryAuditStore() *MemoryAuditStore {
+	return &MemoryAuditStore{}
+}
+
+func (s *MemoryAuditStore) Add(_ context.Context, entry *customTypes.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *entry
+	stored.ID = int64(len(s.entries) + 1)
+	s.entries = append(s.entries, stored)
+
+	return nil
+}
+
+func (s *MemoryAuditStore) List(_ context.Context, quantity int) (*[]customTypes.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entryList := []customTypes.AuditEntry{}
+
+	for i := len(s.entries) - 1; i >= 0 && len(entryList) < quantity; i-- {
+		entryList = append(entryList, s.entries[i])
+	}
+
+	return &entryList, nil
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// IdentityStore links the subjects of an identity provider to admins
+type IdentityStore interface {
+	// GetAdminID returns the admin linked to the subject of the issuer, or an empty ID
+	GetAdminID(ctx context.Context, issuer, subject string) (string, error)
+	Link(ctx context.Context, issuer, subject, adminID string) error
+}
+
+type MemoryIdentityStore struct {
+	mu sync.Mutex
+	// admin IDs by issuer and subject
+	identities map[[2]string]string
+}
+
+func NewMemoryIdentityStore() *MemoryIdentityStore {
+	return &MemoryIdentityStore{identities: make(map[[2]string]string)}
+}
+
+func (s *MemoryIdentityStore) GetAdminID(_ context.Context, issuer, subject string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.identities[[2]string{issuer, subject}], nil
+}
+
+func (s *MemoryIdentityStore) Link(_ context.Context, issuer, subject, adminID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.identities[[2]string{issuer, subject}]; exists {
+		return errors.New("couldn't link admin identity: identity is linked already")
+	}
+
+	s.identities[[2]string{issuer, subject}] = adminID
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// MagicLinkStore keeps the single use login links of users
+type MagicLinkStore interface {
+	Save(ctx context.Context, link *customTypes.MagicLink) error
+	// Consume marks the link as used and returns it, it fails if the link doesn't exist, expired or was used before
+	Consume(ctx context.Context, tokenID string) (*customTypes.MagicLink, error)
+}
+
+type MemoryMagicLinkStore struct {
+	mu    sync.Mutex
+	links map[string]*customTypes.MagicLink
+}
+
+func NewMemoryMagicLinkStore() *MemoryMagicLinkStore {
+	return &MemoryMagicLinkStore{links: make(map[string]*customTypes.MagicLink)}
+}
+
+func (s *MemoryMagicLinkStore) Save(_ context.Context, link *customTypes.MagicLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *link
+	stored.Used = false
+	s.links[link.TokenID] = &stored
+
+	return nil
+}
+
+func (s *MemoryMagicLinkStore) Consume(_ context.Context, tokenID string) (*customTypes.MagicLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	link, exists := s.links[tokenID]
+
+	if !exists || link.Used || link.ExpiresAt < now {
+		return nil, errors.New("invalid or used login link")
+	}
+
+	link.Used = true
+	consumed := *link
+
+	for id, other := range s.links {
+		if other.ExpiresAt < now {
+			delete(s.links, id)
+		}
+	}
+
+	return &consumed, nil
+}
@@ -0,0 +1,166 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// name of the setting which forces every admin to use mfa
+const SettingMFARequired = "mfa_required"
+
+// MFAStore keeps the totp enrollments and recovery codes of admins
+type MFAStore interface {
+	// Get returns the totp enrollment of an admin or nil if the admin never started one
+	Get(ctx context.Context, adminID string) (*customTypes.AdminMFA, error)
+	// SavePending starts a new enrollment, it replaces an enrollment which was never confirmed
+	SavePending(ctx context.Context, adminID, secret string) error
+	// Enable finishes the enrollment and replaces all recovery codes with the new ones
+	Enable(ctx context.Context, adminID string, step int64, recoveryCodeHashes []string) error
+	Disable(ctx context.Context, adminID string) error
+	// UseStep stores the time step of a valid code, false means the step was used concurrently
+	UseStep(ctx context.Context, adminID string, step int64) (bool, error)
+	// UseRecoveryCode marks the code as used, false is returned if it doesn't exist or was used before
+	UseRecoveryCode(ctx context.Context, adminID, codeHash string) (bool, error)
+}
+
+// SettingStore keeps settings which admins change at runtime
+type SettingStore interface {
+	// Get returns the value of a setting or the fallback if it was never set
+	Get(ctx context.Context, name, fallback string) (string, error)
+	Set(ctx context.Context, name, value string) error
+}
+
+type MemoryMFAStore struct {
+	mu  sync.Mutex
+	mfa map[string]*customTypes.AdminMFA
+	// used state of the recovery codes of every admin by their hash
+	recoveryCodes map[string]map[string]bool
+}
+
+func NewMemoryMFAStore() *MemoryMFAStore {
+	return &MemoryMFAStore{
+		mfa:           make(map[string]*customTypes.AdminMFA),
+		recoveryCodes: make(map[string]map[string]bool),
+	}
+}
+
+func (s *MemoryMFAStore) Get(_ context.Context, adminID string) (*customTypes.AdminMFA, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, exists := s.mfa[adminID]
+
+	if !exists {
+		return nil, nil
+	}
+
+	copied := *mfa
+
+	return &copied, nil
+}
+
+func (s *MemoryMFAStore) SavePending(_ context.Context, adminID, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mfa, exists := s.mfa[adminID]; exists && mfa.Enabled {
+		return errors.New("couldn't store mfa secret: mfa already enabled")
+	}
+
+	s.mfa[adminID] = &customTypes.AdminMFA{AdminID: adminID, Secret: secret, Created: time.Now().Unix()}
+
+	return nil
+}
+
+func (s *MemoryMFAStore) Enable(_ context.Context, adminID string, step int64, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if mfa, exists := s.mfa[adminID]; exists {
+		mfa.Enabled = true
+		mfa.LastUsedStep = step
+	}
+
+	codes := make(map[string]bool, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = false
+	}
+
+	s.recoveryCodes[adminID] = codes
+
+	return nil
+}
+
+func (s *MemoryMFAStore) Disable(_ context.Context, adminID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.mfa, adminID)
+	delete(s.recoveryCodes, adminID)
+
+	return nil
+}
+
+func (s *MemoryMFAStore) UseStep(_ context.Context, adminID string, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	mfa, exists := s.mfa[adminID]
+
+	if !exists || mfa.LastUsedStep >= step {
+		return false, nil
+	}
+
+	mfa.LastUsedStep = step
+
+	return true, nil
+}
+
+func (s *MemoryMFAStore) UseRecoveryCode(_ context.Context, adminID, codeHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used, exists := s.recoveryCodes[adminID][codeHash]
+
+	if !exists || used {
+		return false, nil
+	}
+
+	s.recoveryCodes[adminID][codeHash] = true
+
+	return true, nil
+}
+
+type MemorySettingStore struct {
+	mu       sync.Mutex
+	settings map[string]string
+}
+
+func NewMemorySettingStore() *MemorySettingStore {
+	return &MemorySettingStore{settings: make(map[string]string)}
+}
+
+func (s *MemorySettingStore) Get(_ context.Context, name, fallback string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, exists := s.settings[name]
+
+	if !exists {
+		return fallback, nil
+	}
+
+	return value, nil
+}
+
+func (s *MemorySettingStore) Set(_ context.Context, name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings[name] = value
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PasswordResetStore keeps the hashes of the single use reset tokens
+type PasswordResetStore interface {
+	Save(ctx context.Context, reset *customTypes.PasswordReset) error
+	// Get returns an open reset without using it up, e.g. to validate the new password first
+	Get(ctx context.Context, tokenHash string) (*customTypes.PasswordReset, error)
+	// Consume marks the reset as used and returns it, it fails if the token doesn't exist, expired or was used before
+	Consume(ctx context.Context, tokenHash string) (*customTypes.PasswordReset, error)
+	// DeleteOfPerson removes every open reset of a person and expired resets of everyone
+	DeleteOfPerson(ctx context.Context, person customTypes.Person, id string) error
+}
+
+type MemoryPasswordResetStore struct {
+	mu     sync.Mutex
+	resets map[string]*customTypes.PasswordReset
+}
+
+func NewMemoryPasswordResetStore() *MemoryPasswordResetStore {
+	return &MemoryPasswordResetStore{resets: make(map[string]*customTypes.PasswordReset)}
+}
+
+func (s *MemoryPasswordResetStore) Save(_ context.Context, reset *customTypes.PasswordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *reset
+	stored.Used = false
+	s.resets[reset.TokenHash] = &stored
+
+	return nil
+}
+
+// open returns the reset if it can still be used, callers hold mu
+func (s *MemoryPasswordResetStore) open(tokenHash string) *customTypes.PasswordReset {
+	reset, exists := s.resets[tokenHash]
+
+	if !exists || reset.Used || reset.ExpiresAt < time.Now().Unix() {
+		return nil
+	}
+
+	return reset
+}
+
+func (s *MemoryPasswordResetStore) Get(_ context.Context, tokenHash string) (*customTypes.PasswordReset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset := s.open(tokenHash)
+
+	if reset == nil {
+		return nil, errors.New("invalid or expired reset token")
+	}
+
+	copied := *reset
+
+	return &copied, nil
+}
+
+func (s *MemoryPasswordResetStore) Consume(_ context.Context, tokenHash string) (*customTypes.PasswordReset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset := s.open(tokenHash)
+
+	if reset == nil {
+		return nil, errors.New("invalid or expired reset token")
+	}
+
+	reset.Used = true
+	copied := *reset
+
+	return &copied, nil
+}
+
+func (s *MemoryPasswordResetStore) DeleteOfPerson(_ context.Context, person customTypes.Person, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+
+	for hash, reset := range s.resets {
+		if (reset.PersonID == id && reset.PersonType == person) || reset.ExpiresAt < now {
+			delete(s.resets, hash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,757 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PersonStore holds what users and admins have in common, the credentials and the account itself
+type PersonStore interface {
+	// Authenticate checks the password of the email and returns the ID, hashes of an outdated algorithm are upgraded
+	Authenticate(ctx context.Context, email, password string) (string, error)
+	GetIDByEmail(ctx context.Context, email string) (string, error)
+	GetEmail(ctx context.Context, id string) (string, error)
+	CheckPassword(ctx context.Context, id, password string) error
+	// SetPassword hashes the new password, a pending forced password change is done with it
+	SetPassword(ctx context.Context, id, password string) error
+	MustChangePassword(ctx context.Context, id string) (bool, error)
+	SetMustChangePassword(ctx context.Context, id string, mustChange bool) error
+	Delete(ctx context.Context, id string) error
+}
+
+// UserStore persists users, handlers get it injected so they can run without a database
+type UserStore interface {
+	PersonStore
+	// Register creates a user, the email stays unverified until the link sent to it was opened
+	Register(ctx context.Context, usr customTypes.RegisterUserRequest) (*customTypes.User, error)
+	GetByID(ctx context.Context, id string) (*customTypes.User, error)
+	List(ctx context.Context, quantity int) ([]customTypes.User, error)
+	Search(ctx context.Context, request *customTypes.SearchUserRequest) ([]customTypes.User, error)
+	// Edit updates the profile, a changed email has to be verified again
+	Edit(ctx context.Context, id string, usr *customTypes.EditUserRequest) error
+	GetLoginMethods(ctx context.Context, id string) (string, error)
+	SetLoginMethods(ctx context.Context, id, methods string) error
+	// MarkEmailVerified verifies the email if the user still has it
+	MarkEmailVerified(ctx context.Context, id, email string) error
+}
+
+// AdminStore persists admins and the roles assigned to them
+type AdminStore interface {
+	PersonStore
+	Add(ctx context.Context, adm *customTypes.AddAdminRequest) (*customTypes.Admin, error)
+	GetByID(ctx context.Context, id string) (*customTypes.Admin, error)
+	List(ctx context.Context, quantity int) ([]customTypes.Admin, error)
+	Edit(ctx context.Context, id string, adm *customTypes.EditAdminRequest) error
+	GetRoles(ctx context.Context, id string) ([]string, error)
+	// SetRoles replaces all roles of an admin, the last superadmin can't lose the role
+	SetRoles(ctx context.Context, id string, roles []string) error
+}
+
+// ErrEmailInUse is returned by the stores if another user or admin has the email already
+var ErrEmailInUse = errors.New("email already in use")
+
+// NormalizeEmail is applied to every email before it is stored or looked up, addresses differing only in case are the same
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// memoryPerson is what users and admins share in the memory stores
+type memoryPerson struct {
+	id                 string
+	email              string
+	password           string
+	mustChangePassword bool
+}
+
+// memoryPersons implements the PersonStore part of the memory stores, callers hold mu
+type memoryPersons struct {
+	mu     sync.Mutex
+	hasher utils.PasswordHasher
+}
+
+func (s *memoryPersons) authenticate(person *memoryPerson, password string) (string, error) {
+	if person == nil {
+		return "", errors.New("email doesn't exist")
+	}
+
+	if !utils.VerifyPassword(person.password, password) {
+		return "", errors.New("wrong password")
+	}
+
+	if s.hasher.NeedsRehash(person.password) {
+		hashedPassword, err := s.hasher.Hash(password)
+
+		if err == nil {
+			person.password = hashedPassword
+		}
+	}
+
+	return person.id, nil
+}
+
+func (s *memoryPersons) checkPassword(person *memoryPerson, password string) error {
+	if person == nil {
+		return errors.New("person not found")
+	}
+
+	if !utils.VerifyPassword(person.password, password) {
+		return errors.New("wrong password")
+	}
+
+	return nil
+}
+
+func (s *memoryPersons) setPassword(person *memoryPerson, password string) error {
+	if person == nil {
+		return errors.New("no rows affected")
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
+
+	if err != nil {
+		return err
+	}
+
+	person.password = hashedPassword
+	person.mustChangePassword = false
+
+	return nil
+}
+
+type memoryUser struct {
+	memoryPerson
+	user         customTypes.User
+	loginMethods string
+}
+
+// MemoryUserStore keeps users in memory, it lets the api run in tests without a database
+type MemoryUserStore struct {
+	memoryPersons
+	users []*memoryUser
+}
+
+func NewMemoryUserStore(hasher utils.PasswordHasher) *MemoryUserStore {
+	return &MemoryUserStore{memoryPersons: memoryPersons{hasher: hasher}}
+}
+
+func (s *MemoryUserStore) byID(id string) *memoryUser {
+	for _, usr := range s.users {
+		if usr.id == id {
+			return usr
+		}
+	}
+
+	return nil
+}
+
+// byEmail normalizes the email like the stores do before saving it
+func (s *MemoryUserStore) byEmail(email string) *memoryUser {
+	for _, usr := range s.users {
+		if usr.email == NormalizeEmail(email) {
+			return usr
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryUserStore) person(usr *memoryUser) *memoryPerson {
+	if usr == nil {
+		return nil
+	}
+
+	return &usr.memoryPerson
+}
+
+func (s *MemoryUserStore) Authenticate(_ context.Context, email, password string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.authenticate(s.person(s.byEmail(email)), password)
+}
+
+func (s *MemoryUserStore) GetIDByEmail(_ context.Context, email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byEmail(email)
+
+	if usr == nil {
+		return "", errors.New("email doesn't exist")
+	}
+
+	return usr.id, nil
+}
+
+func (s *MemoryUserStore) GetEmail(_ context.Context, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byID(id)
+
+	if usr == nil {
+		return "", errors.New("person not found")
+	}
+
+	return usr.email, nil
+}
+
+func (s *MemoryUserStore) CheckPassword(_ context.Context, id, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkPassword(s.person(s.byID(id)), password)
+}
+
+func (s *MemoryUserStore) SetPassword(_ context.Context, id, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setPassword(s.person(s.byID(id)), password)
+}
+
+func (s *MemoryUserStore) MustChangePassword(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byID(id)
+
+	if usr == nil {
+		return false, errors.New("person not found")
+	}
+
+	return usr.mustChangePassword, nil
+}
+
+func (s *MemoryUserStore) SetMustChangePassword(_ context.Context, id string, mustChange bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byID(id)
+
+	if usr == nil {
+		return errors.New("person not found")
+	}
+
+	usr.mustChangePassword = mustChange
+
+	return nil
+}
+
+func (s *MemoryUserStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, usr := range s.users {
+		if usr.id == id {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("no rows affected")
+}
+
+func (s *MemoryUserStore) Register(_ context.Context, usr customTypes.RegisterUserRequest) (*customTypes.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := NormalizeEmail(usr.Email)
+
+	if s.byEmail(email) != nil {
+		return nil, ErrEmailInUse
+	}
+
+	id, err := uuid.NewUUID()
+
+	if err != nil {
+		return nil, errors.New("couldn't generate UUID: " + err.Error())
+	}
+
+	hashedPassword, err := s.hasher.Hash(usr.Password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	newUser := customTypes.User{
+		ID:        id,
+		FirstName: usr.FirstName,
+		LastName:  usr.LastName,
+		Email:     email,
+		Password:  hashedPassword,
+		Created:   int(time.Now().Unix()),
+	}
+
+	s.users = append(s.users, &memoryUser{
+		memoryPerson: memoryPerson{id: id.String(), email: email, password: hashedPassword},
+		user:         newUser,
+		loginMethods: customTypes.LoginMethodBoth,
+	})
+
+	return &newUser, nil
+}
+
+// copy returns the user without its password like the database queries do
+func (usr *memoryUser) copy() customTypes.User {
+	copied := usr.user
+	copied.Email = usr.email
+	copied.Password = ""
+
+	return copied
+}
+
+func (s *MemoryUserStore) GetByID(_ context.Context, id string) (*customTypes.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byID(id)
+
+	if usr == nil {
+		return nil, errors.New("user not found")
+	}
+
+	copied := usr.copy()
+
+	return &copied, nil
+}
+
+func (s *MemoryUserStore) List(_ context.Context, quantity int) ([]customTypes.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var userList []customTypes.User
+
+	for _, usr := range s.users {
+		if len(userList) >= quantity {
+			break
+		}
+
+		userList = append(userList, usr.copy())
+	}
+
+	return userList, nil
+}
+
+// Search matches like the LIKE query of the database, empty fields match every user
+func (s *MemoryUserStore) Search(_ context.Context, request *customTypes.SearchUserRequest) ([]customTypes.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var userList []customTypes.User
+
+	contains := func(value, search string) bool {
+		return strings.Contains(strings.ToLower(value), strings.ToLower(search))
+	}
+
+	for _, usr := range s.users {
+		if usr.id == request.ID || contains(usr.user.FirstName, request.FirstName) || contains(usr.user.LastName, request.LastName) || contains(usr.email, request.Email) {
+			userList = append(userList, usr.copy())
+		}
+	}
+
+	return userList, nil
+}
+
+func (s *MemoryUserStore) Edit(_ context.Context, id string, edit *customTypes.EditUserRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byID(id)
+
+	if usr == nil {
+		return errors.New("no rows affected")
+	}
+
+	email := NormalizeEmail(edit.Email)
+
+	if other := s.byEmail(email); other != nil && other != usr {
+		return ErrEmailInUse
+	}
+
+	// a changed email has to be verified again
+	if usr.email != email {
+		usr.user.EmailVerified = false
+	}
+
+	usr.user.FirstName = edit.FirstName
+	usr.user.LastName = edit.LastName
+	usr.email = email
+
+	return nil
+}
+
+func (s *MemoryUserStore) GetLoginMethods(_ context.Context, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byID(id)
+
+	if usr == nil {
+		return "", errors.New("user not found")
+	}
+
+	return usr.loginMethods, nil
+}
+
+func (s *MemoryUserStore) SetLoginMethods(_ context.Context, id, methods string) error {
+	switch methods {
+	case customTypes.LoginMethodPassword, customTypes.LoginMethodMagicLink, customTypes.LoginMethodBoth:
+	default:
+		return errors.New("invalid login methods " + methods)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byID(id)
+
+	if usr == nil {
+		return errors.New("user not found")
+	}
+
+	usr.loginMethods = methods
+
+	return nil
+}
+
+func (s *MemoryUserStore) MarkEmailVerified(_ context.Context, id, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usr := s.byID(id)
+
+	if usr != nil && usr.email == NormalizeEmail(email) {
+		usr.user.EmailVerified = true
+	}
+
+	return nil
+}
+
+type memoryAdmin struct {
+	memoryPerson
+	admin customTypes.Admin
+}
+
+// MemoryAdminStore keeps admins in memory, only the default roles can be assigned
+type MemoryAdminStore struct {
+	memoryPersons
+	admins []*memoryAdmin
+}
+
+func NewMemoryAdminStore(hasher utils.PasswordHasher) *MemoryAdminStore {
+	return &MemoryAdminStore{memoryPersons: memoryPersons{hasher: hasher}}
+}
+
+func (s *MemoryAdminStore) byID(id string) *memoryAdmin {
+	for _, adm := range s.admins {
+		if adm.id == id {
+			return adm
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryAdminStore) byEmail(email string) *memoryAdmin {
+	for _, adm := range s.admins {
+		if adm.email == NormalizeEmail(email) {
+			return adm
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryAdminStore) person(adm *memoryAdmin) *memoryPerson {
+	if adm == nil {
+		return nil
+	}
+
+	return &adm.memoryPerson
+}
+
+func (s *MemoryAdminStore) Authenticate(_ context.Context, email, password string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.authenticate(s.person(s.byEmail(email)), password)
+}
+
+func (s *MemoryAdminStore) GetIDByEmail(_ context.Context, email string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adm := s.byEmail(email)
+
+	if adm == nil {
+		return "", errors.New("email doesn't exist")
+	}
+
+	return adm.id, nil
+}
+
+func (s *MemoryAdminStore) GetEmail(_ context.Context, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adm := s.byID(id)
+
+	if adm == nil {
+		return "", errors.New("person not found")
+	}
+
+	return adm.email, nil
+}
+
+func (s *MemoryAdminStore) CheckPassword(_ context.Context, id, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.checkPassword(s.person(s.byID(id)), password)
+}
+
+func (s *MemoryAdminStore) SetPassword(_ context.Context, id, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.setPassword(s.person(s.byID(id)), password)
+}
+
+func (s *MemoryAdminStore) MustChangePassword(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adm := s.byID(id)
+
+	if adm == nil {
+		return false, errors.New("person not found")
+	}
+
+	return adm.mustChangePassword, nil
+}
+
+func (s *MemoryAdminStore) SetMustChangePassword(_ context.Context, id string, mustChange bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adm := s.byID(id)
+
+	if adm == nil {
+		return errors.New("person not found")
+	}
+
+	adm.mustChangePassword = mustChange
+
+	return nil
+}
+
+func (s *MemoryAdminStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.ensureOtherSuperadmin(id)
+
+	if err != nil {
+		return err
+	}
+
+	for i, adm := range s.admins {
+		if adm.id == id {
+			s.admins = append(s.admins[:i], s.admins[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("no rows affected")
+}
+
+func (s *MemoryAdminStore) Add(_ context.Context, add *customTypes.AddAdminRequest) (*customTypes.Admin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := NormalizeEmail(add.Email)
+
+	if s.byEmail(email) != nil {
+		return nil, ErrEmailInUse
+	}
+
+	err := validateMemoryRoles(add.Roles)
+
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewUUID()
+
+	if err != nil {
+		return nil, errors.New("couldn't generate UUID: " + err.Error())
+	}
+
+	hashedPassword, err := s.hasher.Hash(add.Password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	newAdmin := customTypes.Admin{
+		ID:       id,
+		UserName: add.UserName,
+		Email:    email,
+		Password: hashedPassword,
+		Created:  int(time.Now().Unix()),
+		Roles:    append([]string{}, add.Roles...),
+	}
+
+	s.admins = append(s.admins, &memoryAdmin{
+		memoryPerson: memoryPerson{id: id.String(), email: email, password: hashedPassword},
+		admin:        newAdmin,
+	})
+
+	return &newAdmin, nil
+}
+
+func (adm *memoryAdmin) copy() customTypes.Admin {
+	copied := adm.admin
+	copied.Email = adm.email
+	copied.Password = ""
+	copied.Roles = append([]string{}, adm.admin.Roles...)
+
+	return copied
+}
+
+func (s *MemoryAdminStore) GetByID(_ context.Context, id string) (*customTypes.Admin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adm := s.byID(id)
+
+	if adm == nil {
+		return nil, errors.New("admin not found")
+	}
+
+	copied := adm.copy()
+
+	return &copied, nil
+}
+
+func (s *MemoryAdminStore) List(_ context.Context, quantity int) ([]customTypes.Admin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var adminList []customTypes.Admin
+
+	for _, adm := range s.admins {
+		if len(adminList) >= quantity {
+			break
+		}
+
+		adminList = append(adminList, adm.copy())
+	}
+
+	return adminList, nil
+}
+
+func (s *MemoryAdminStore) Edit(_ context.Context, id string, edit *customTypes.EditAdminRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adm := s.byID(id)
+
+	if adm == nil {
+		return errors.New("no rows affected")
+	}
+
+	email := NormalizeEmail(edit.Email)
+
+	if other := s.byEmail(email); other != nil && other != adm {
+		return ErrEmailInUse
+	}
+
+	adm.admin.UserName = edit.UserName
+	adm.email = email
+
+	return nil
+}
+
+func (s *MemoryAdminStore) GetRoles(_ context.Context, id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	adm := s.byID(id)
+
+	if adm == nil {
+		return []string{}, nil
+	}
+
+	return append([]string{}, adm.admin.Roles...), nil
+}
+
+func (s *MemoryAdminStore) SetRoles(_ context.Context, id string, roles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := validateMemoryRoles(roles)
+
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(roles, customTypes.RoleSuperadmin) {
+		err = s.ensureOtherSuperadmin(id)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	adm := s.byID(id)
+
+	if adm != nil {
+		adm.admin.Roles = append([]string{}, roles...)
+	}
+
+	return nil
+}
+
+// ensureOtherSuperadmin fails if the admin is the only one left who can manage admins
+func (s *MemoryAdminStore) ensureOtherSuperadmin(id string) error {
+	isSuperadmin := false
+
+	for _, adm := range s.admins {
+		if !slices.Contains(adm.admin.Roles, customTypes.RoleSuperadmin) {
+			continue
+		}
+
+		if adm.id != id {
+			return nil
+		}
+
+		isSuperadmin = true
+	}
+
+	if isSuperadmin {
+		return errors.New("the last superadmin can't be removed")
+	}
+
+	return nil
+}
+
+// validateMemoryRoles only accepts the default roles, the database validates them against the roles table instead
+func validateMemoryRoles(roles []string) error {
+	for _, role := range roles {
+		if !slices.ContainsFunc(DefaultRoles, func(defaultRole customTypes.Role) bool { return defaultRole.Name == role }) {
+			return errors.New("role " + role + " doesn't exist")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,445 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"backend/src/utils"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testPassword = "Correct-Horse-7"
+
+func testHasher() utils.PasswordHasher {
+	return &utils.BcryptHasher{Cost: 4}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{email: "ada@example.com", want: "ada@example.com"},
+		{email: "Ada@Example.COM", want: "ada@example.com"},
+		{email: "  ada@example.com\t", want: "ada@example.com"},
+		{email: "", want: ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeEmail(test.email); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.email, got, test.want)
+		}
+	}
+}
+
+func TestMemoryUserStoreRegister(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore(testHasher())
+
+	usr, err := users.Register(ctx, customTypes.RegisterUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: " Ada@Example.com", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usr.Email != "ada@example.com" || usr.EmailVerified {
+		t.Errorf("got %+v, want a normalized and unverified email", usr)
+	}
+
+	tests := []struct {
+		name  string
+		email string
+		err   error
+	}{
+		{name: "same email", email: "ada@example.com", err: ErrEmailInUse},
+		{name: "differing in case", email: "ADA@example.com", err: ErrEmailInUse},
+		{name: "differing in spaces", email: "ada@example.com ", err: ErrEmailInUse},
+		{name: "other email", email: "grace@example.com"},
+	}
+
+	for _, test := range tests {
+		_, err := users.Register(ctx, customTypes.RegisterUserRequest{FirstName: "Ada", LastName: "Lovelace", Email: test.email, Password: testPassword})
+
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	stored, err := users.GetByID(ctx, usr.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Password != "" {
+		t.Error("the stored user was returned with its password")
+	}
+}
+
+func TestMemoryUserStoreAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore(testHasher())
+
+	usr, err := users.Register(ctx, customTypes.RegisterUserRequest{Email: "ada@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		fails    bool
+	}{
+		{name: "correct password", email: "ada@example.com", password: testPassword},
+		{name: "email differing in case", email: " ADA@example.com", password: testPassword},
+		{name: "wrong password", email: "ada@example.com", password: "Correct-Horse-8", fails: true},
+		{name: "unknown email", email: "grace@example.com", password: testPassword, fails: true},
+	}
+
+	for _, test := range tests {
+		id, err := users.Authenticate(ctx, test.email, test.password)
+
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got id %s, want an error", test.name, id)
+			}
+			continue
+		}
+
+		if err != nil || id != usr.ID.String() {
+			t.Errorf("%s: got %s %v, want %s", test.name, id, err, usr.ID)
+		}
+	}
+}
+
+// a bcrypt hash is replaced by an argon2id hash at the next login once argon2id is configured
+func TestMemoryUserStoreRehashOnLogin(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore(testHasher())
+
+	usr, err := users.Register(ctx, customTypes.RegisterUserRequest{Email: "ada@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users.hasher = &utils.Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+	// a wrong password must not upgrade the hash
+	_, err = users.Authenticate(ctx, "ada@example.com", "Correct-Horse-8")
+	if err == nil {
+		t.Fatal("wrong password was accepted")
+	}
+
+	if !strings.HasPrefix(users.byID(usr.ID.String()).password, "$2a$") {
+		t.Error("hash was upgraded by a failed login")
+	}
+
+	_, err = users.Authenticate(ctx, "ada@example.com", testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := users.byID(usr.ID.String()).password
+
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		t.Errorf("got hash %s, want an argon2id hash", hash)
+	}
+
+	err = users.CheckPassword(ctx, usr.ID.String(), testPassword)
+	if err != nil {
+		t.Errorf("upgraded hash doesn't match the password: %v", err)
+	}
+}
+
+func TestMemoryUserStoreSetPassword(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore(testHasher())
+
+	usr, err := users.Register(ctx, customTypes.RegisterUserRequest{Email: "ada@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := usr.ID.String()
+
+	err = users.SetMustChangePassword(ctx, id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = users.SetPassword(ctx, id, "Battery-Staple-9")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustChange, err := users.MustChangePassword(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mustChange {
+		t.Error("setting the password didn't finish the forced password change")
+	}
+
+	tests := []struct {
+		password string
+		fails    bool
+	}{
+		{password: "Battery-Staple-9"},
+		{password: testPassword, fails: true},
+	}
+
+	for _, test := range tests {
+		err := users.CheckPassword(ctx, id, test.password)
+
+		if (err != nil) != test.fails {
+			t.Errorf("%s: got %v, want failing %t", test.password, err, test.fails)
+		}
+	}
+
+	err = users.SetPassword(ctx, "unknown", "Battery-Staple-9")
+	if err == nil {
+		t.Error("password of an unknown user was set")
+	}
+}
+
+func TestMemoryUserStoreEdit(t *testing.T) {
+	tests := []struct {
+		name string
+		// the email the user is edited to and the email the verification link was sent to afterwards
+		email    string
+		verify   string
+		err      error
+		verified bool
+	}{
+		{name: "same email", email: "ada@example.com", verify: "ada@example.com", verified: true},
+		{name: "same email differing in case", email: "ADA@example.com", verify: "ada@example.com", verified: true},
+		{name: "new email verified", email: "ada@lovelace.org", verify: "ada@lovelace.org", verified: true},
+		{name: "link of the old email", email: "ada@lovelace.org", verify: "ada@example.com", verified: false},
+		{name: "email of another user", email: " Grace@example.com", verify: "ada@example.com", err: ErrEmailInUse, verified: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := NewMemoryUserStore(testHasher())
+
+			usr, err := users.Register(ctx, customTypes.RegisterUserRequest{Email: "ada@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = users.Register(ctx, customTypes.RegisterUserRequest{Email: "grace@example.com", Password: testPassword})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id := usr.ID.String()
+
+			err = users.MarkEmailVerified(ctx, id, "ada@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = users.Edit(ctx, id, &customTypes.EditUserRequest{FirstName: "Ada", LastName: "King", Email: test.email})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+
+			err = users.MarkEmailVerified(ctx, id, test.verify)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			edited, err := users.GetByID(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if edited.EmailVerified != test.verified {
+				t.Errorf("got verified %t, want %t", edited.EmailVerified, test.verified)
+			}
+
+			if test.err == nil && (edited.Email != NormalizeEmail(test.email) || edited.LastName != "King") {
+				t.Errorf("got %+v, want the edited profile", edited)
+			}
+		})
+	}
+}
+
+func TestMemoryUserStoreDelete(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryUserStore(testHasher())
+
+	usr, err := users.Register(ctx, customTypes.RegisterUserRequest{Email: "ada@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = users.Delete(ctx, usr.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = users.Delete(ctx, usr.ID.String())
+	if err == nil {
+		t.Error("deleting a deleted user succeeded")
+	}
+
+	_, err = users.Authenticate(ctx, "ada@example.com", testPassword)
+	if err == nil {
+		t.Error("deleted user could log in")
+	}
+
+	// the email is free again
+	_, err = users.Register(ctx, customTypes.RegisterUserRequest{Email: "ada@example.com", Password: testPassword})
+	if err != nil {
+		t.Errorf("got %v, want the email to be free again", err)
+	}
+}
+
+func TestMemoryAdminStoreAdd(t *testing.T) {
+	ctx := context.Background()
+	admins := NewMemoryAdminStore(testHasher())
+
+	tests := []struct {
+		name  string
+		email string
+		roles []string
+		fails bool
+		err   error
+	}{
+		{name: "superadmin", email: " Julian@Example.com", roles: []string{customTypes.RoleSuperadmin}},
+		{name: "several roles", email: "support@example.com", roles: []string{customTypes.RoleSupport, customTypes.RoleOps}},
+		{name: "without roles", email: "nobody@example.com"},
+		{name: "unknown role", email: "root@example.com", roles: []string{"root"}, fails: true},
+		{name: "email differing in case", email: "JULIAN@example.com", roles: []string{customTypes.RoleOps}, fails: true, err: ErrEmailInUse},
+	}
+
+	for _, test := range tests {
+		adm, err := admins.Add(ctx, &customTypes.AddAdminRequest{UserName: "Julian", Email: test.email, Password: testPassword, Roles: test.roles})
+
+		if test.fails {
+			if err == nil || (test.err != nil && !errors.Is(err, test.err)) {
+				t.Errorf("%s: got %v, want an error", test.name, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		roles, err := admins.GetRoles(ctx, adm.ID.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(roles, test.roles) {
+			t.Errorf("%s: got roles %q, want %q", test.name, roles, test.roles)
+		}
+
+		if adm.Email != NormalizeEmail(test.email) {
+			t.Errorf("%s: got email %s, want %s", test.name, adm.Email, NormalizeEmail(test.email))
+		}
+	}
+}
+
+func TestMemoryAdminStoreLastSuperadmin(t *testing.T) {
+	tests := []struct {
+		name string
+		// superadmins is how many of the two admins are superadmins, the first one is changed
+		superadmins int
+		change      func(ctx context.Context, admins *MemoryAdminStore, id string) error
+		fails       bool
+	}{
+		{
+			name:        "remove the role of the last superadmin",
+			superadmins: 1,
+			change: func(ctx context.Context, admins *MemoryAdminStore, id string) error {
+				return admins.SetRoles(ctx, id, []string{customTypes.RoleSupport})
+			},
+			fails: true,
+		},
+		{
+			name:        "delete the last superadmin",
+			superadmins: 1,
+			change: func(ctx context.Context, admins *MemoryAdminStore, id string) error {
+				return admins.Delete(ctx, id)
+			},
+			fails: true,
+		},
+		{
+			name:        "keep the role of the last superadmin",
+			superadmins: 1,
+			change: func(ctx context.Context, admins *MemoryAdminStore, id string) error {
+				return admins.SetRoles(ctx, id, []string{customTypes.RoleSuperadmin, customTypes.RoleOps})
+			},
+		},
+		{
+			name:        "remove the role of one of two superadmins",
+			superadmins: 2,
+			change: func(ctx context.Context, admins *MemoryAdminStore, id string) error {
+				return admins.SetRoles(ctx, id, []string{})
+			},
+		},
+		{
+			name:        "delete one of two superadmins",
+			superadmins: 2,
+			change: func(ctx context.Context, admins *MemoryAdminStore, id string) error {
+				return admins.Delete(ctx, id)
+			},
+		},
+		{
+			name:        "unknown role",
+			superadmins: 2,
+			change: func(ctx context.Context, admins *MemoryAdminStore, id string) error {
+				return admins.SetRoles(ctx, id, []string{"root"})
+			},
+			fails: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			admins := NewMemoryAdminStore(testHasher())
+
+			var ids []string
+
+			for i, email := range []string{"julian@example.com", "ops@example.com"} {
+				roles := []string{customTypes.RoleOps}
+
+				if i < test.superadmins {
+					roles = []string{customTypes.RoleSuperadmin}
+				}
+
+				adm, err := admins.Add(ctx, &customTypes.AddAdminRequest{UserName: "Julian", Email: email, Password: testPassword, Roles: roles})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				ids = append(ids, adm.ID.String())
+			}
+
+			err := test.change(ctx, admins, ids[0])
+
+			if (err != nil) != test.fails {
+				t.Fatalf("got %v, want failing %t", err, test.fails)
+			}
+
+			// a refused change leaves the superadmin untouched
+			if test.fails {
+				roles, err := admins.GetRoles(ctx, ids[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !slices.Contains(roles, customTypes.RoleSuperadmin) {
+					t.Errorf("got roles %q, want the superadmin role kept", roles)
+				}
+			}
+		})
+	}
+}
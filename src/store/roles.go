@@ -0,0 +1,87 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"slices"
+	"strings"
+)
+
+// DefaultPermissions exist in every installation, the database only inserts them if they don't exist yet
+var DefaultPermissions = map[string]string{
+	customTypes.PermUsersRead:        "read users",
+	customTypes.PermUsersWrite:       "edit users",
+	customTypes.PermUsersDelete:      "delete users",
+	customTypes.PermAdminsRead:       "read admins and roles",
+	customTypes.PermAdminsWrite:      "create, edit and delete admins and assign roles",
+	customTypes.PermDockerRead:       "read docker containers and logs",
+	customTypes.PermUsersImpersonate: "act as a user, every request is audited",
+}
+
+// DefaultRoles are seeded into the database, the memory stores only know these
+var DefaultRoles = []customTypes.Role{
+	{
+		Name:        customTypes.RoleSuperadmin,
+		Description: "manages admins, has every permission",
+		Permissions: []string{customTypes.PermUsersRead, customTypes.PermUsersWrite, customTypes.PermUsersDelete, customTypes.PermAdminsRead, customTypes.PermAdminsWrite, customTypes.PermDockerRead, customTypes.PermUsersImpersonate},
+	},
+	{
+		Name:        customTypes.RoleSupport,
+		Description: "reads and impersonates users",
+		Permissions: []string{customTypes.PermUsersRead, customTypes.PermUsersImpersonate},
+	},
+	{
+		Name:        customTypes.RoleOps,
+		Description: "reads docker containers",
+		Permissions: []string{customTypes.PermDockerRead},
+	},
+}
+
+// RoleStore resolves the permissions of roles, the roles of an admin are kept by the AdminStore
+type RoleStore interface {
+	// List returns every role with its permissions, ordered by name
+	List(ctx context.Context) (*[]customTypes.Role, error)
+	// GetPermissions returns every permission granted by at least one of the roles
+	GetPermissions(ctx context.Context, roles []string) ([]string, error)
+}
+
+// MemoryRoleStore only has the default roles, they can't be changed
+type MemoryRoleStore struct{}
+
+func NewMemoryRoleStore() *MemoryRoleStore {
+	return &MemoryRoleStore{}
+}
+
+func (s *MemoryRoleStore) List(_ context.Context) (*[]customTypes.Role, error) {
+	roleList := []customTypes.Role{}
+
+	for _, role := range DefaultRoles {
+		role.Permissions = append([]string{}, role.Permissions...)
+		slices.Sort(role.Permissions)
+		roleList = append(roleList, role)
+	}
+
+	slices.SortFunc(roleList, func(a, b customTypes.Role) int { return strings.Compare(a.Name, b.Name) })
+
+	return &roleList, nil
+}
+
+func (s *MemoryRoleStore) GetPermissions(_ context.Context, roles []string) ([]string, error) {
+	permissions := []string{}
+
+	for _, role := range DefaultRoles {
+		if !slices.Contains(roles, role.Name) {
+			continue
+		}
+
+		for _, permission := range role.Permissions {
+			if !slices.Contains(permissions, permission) {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	slices.Sort(permissions)
+
+	return permissions, nil
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// SessionStore keeps the logins and their refresh tokens, the family of a refresh token is the ID of its session
+type SessionStore interface {
+	Create(ctx context.Context, session *customTypes.Session) error
+	Get(ctx context.Context, sessionID string) (*customTypes.Session, error)
+	// ListOfPerson returns the active sessions of a user or admin, the newest first
+	ListOfPerson(ctx context.Context, person customTypes.Person, personID string) (*[]customTypes.Session, error)
+	// Touch updates LastSeen, at most once per minute so not every request writes
+	Touch(ctx context.Context, sessionID string, now time.Time) error
+	// Extend is called when the refresh token is rotated, the session lives as long as its refresh token
+	Extend(ctx context.Context, sessionID string, now time.Time, expiresAt int64) error
+	// Revoke ends the session and every refresh token of it
+	Revoke(ctx context.Context, sessionID string) error
+	// RevokeOfPerson logs a user or admin out everywhere
+	RevokeOfPerson(ctx context.Context, person customTypes.Person, personID string) error
+	SaveRefreshToken(ctx context.Context, token *customTypes.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (*customTypes.RefreshToken, error)
+	// ConsumeRefreshToken revokes a refresh token so it can only be rotated once, false means it was used before
+	ConsumeRefreshToken(ctx context.Context, tokenHash string) (bool, error)
+	// DeleteExpired removes sessions and refresh tokens which expired anyway
+	DeleteExpired(ctx context.Context) error
+}
+
+// RevocationStore is the deny list of access tokens which were revoked before they expired
+type RevocationStore interface {
+	Revoke(ctx context.Context, tokenID string, expiresAt int64) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+	// DeleteExpired forgets tokens which expired anyway
+	DeleteExpired(ctx context.Context) error
+}
+
+type MemorySessionStore struct {
+	mu            sync.Mutex
+	sessions      map[string]*customTypes.Session
+	refreshTokens map[string]*customTypes.RefreshToken
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:      make(map[string]*customTypes.Session),
+		refreshTokens: make(map[string]*customTypes.RefreshToken),
+	}
+}
+
+func (s *MemorySessionStore) Create(_ context.Context, session *customTypes.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *session
+	stored.Revoked = false
+	stored.Current = false
+	s.sessions[session.ID] = &stored
+
+	return nil
+}
+
+func (s *MemorySessionStore) Get(_ context.Context, sessionID string) (*customTypes.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+
+	if !exists {
+		return nil, errors.New("session not found")
+	}
+
+	copied := *session
+
+	return &copied, nil
+}
+
+func (s *MemorySessionStore) ListOfPerson(_ context.Context, person customTypes.Person, personID string) (*[]customTypes.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+	sessionList := []customTypes.Session{}
+
+	for _, session := range s.sessions {
+		if session.PersonID == personID && session.PersonType == person && !session.Revoked && session.ExpiresAt >= now {
+			sessionList = append(sessionList, *session)
+		}
+	}
+
+	slices.SortFunc(sessionList, func(a, b customTypes.Session) int { return cmp.Compare(b.LastSeen, a.LastSeen) })
+
+	return &sessionList, nil
+}
+
+func (s *MemorySessionStore) Touch(_ context.Context, sessionID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+
+	if exists && session.LastSeen < now.Add(-time.Minute).Unix() {
+		session.LastSeen = now.Unix()
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) Extend(_ context.Context, sessionID string, now time.Time, expiresAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+
+	if exists {
+		session.LastSeen = now.Unix()
+		session.ExpiresAt = expiresAt
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) Revoke(_ context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, exists := s.sessions[sessionID]; exists {
+		session.Revoked = true
+	}
+
+	for _, token := range s.refreshTokens {
+		if token.FamilyID == sessionID {
+			token.Revoked = true
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) RevokeOfPerson(_ context.Context, person customTypes.Person, personID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.PersonID == personID && session.PersonType == person {
+			session.Revoked = true
+		}
+	}
+
+	for _, token := range s.refreshTokens {
+		if token.PersonID == personID && token.PersonType == person {
+			token.Revoked = true
+		}
+	}
+
+	return nil
+}
+
+func (s *MemorySessionStore) SaveRefreshToken(_ context.Context, token *customTypes.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.refreshTokens[token.TokenHash]; exists {
+		return errors.New("couldn't store refresh token: duplicate token")
+	}
+
+	stored := *token
+	stored.Revoked = false
+	s.refreshTokens[token.TokenHash] = &stored
+
+	return nil
+}
+
+func (s *MemorySessionStore) GetRefreshToken(_ context.Context, tokenHash string) (*customTypes.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.refreshTokens[tokenHash]
+
+	if !exists {
+		return nil, errors.New("refresh token not found")
+	}
+
+	copied := *token
+
+	return &copied, nil
+}
+
+func (s *MemorySessionStore) ConsumeRefreshToken(_ context.Context, tokenHash string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.refreshTokens[tokenHash]
+
+	if !exists || token.Revoked {
+		return false, nil
+	}
+
+	token.Revoked = true
+
+	return true, nil
+}
+
+func (s *MemorySessionStore) DeleteExpired(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+
+	for hash, token := range s.refreshTokens {
+		if token.ExpiresAt < now {
+			delete(s.refreshTokens, hash)
+		}
+	}
+
+	for id, session := range s.sessions {
+		if session.ExpiresAt < now {
+			delete(s.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+type MemoryRevocationStore struct {
+	mu sync.Mutex
+	// expiry of every revoked token by its ID
+	revoked map[string]int64
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{revoked: make(map[string]int64)}
+}
+
+func (s *MemoryRevocationStore) Revoke(_ context.Context, tokenID string, expiresAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.revoked[tokenID]; !exists {
+		s.revoked[tokenID] = expiresAt
+	}
+
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, tokenID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.revoked[tokenID]
+
+	return exists, nil
+}
+
+func (s *MemoryRevocationStore) DeleteExpired(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Unix()
+
+	for id, expiresAt := range s.revoked {
+		if expiresAt < now {
+			delete(s.revoked, id)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+Package store defines what the api reads and writes, every kind of record is behind an interface.
+The db package implements them on the database, the memory stores let the api run without one, e.g. in tests
+*/
+package store
+
+import (
+	"backend/src/utils"
+)
+
+// Stores are passed to the router, the handlers only work with these
+type Stores struct {
+	Users          UserStore
+	Admins         AdminStore
+	Roles          RoleStore
+	Sessions       SessionStore
+	Revocations    RevocationStore
+	MFA            MFAStore
+	Settings       SettingStore
+	ApiKeys        ApiKeyStore
+	Audit          AuditStore
+	Identities     IdentityStore
+	MagicLinks     MagicLinkStore
+	PasswordResets PasswordResetStore
+	Verifications  VerificationStore
+	// Attempts are the failed logins the rate limiter counts
+	Attempts utils.AttemptStore
+}
+
+// NewMemoryStores keeps everything in memory, it is lost on restart and not shared between replicas
+func NewMemoryStores(hasher utils.PasswordHasher) *Stores {
+	users := NewMemoryUserStore(hasher)
+
+	return &Stores{
+		Users:          users,
+		Admins:         NewMemoryAdminStore(hasher),
+		Roles:          NewMemoryRoleStore(),
+		Sessions:       NewMemorySessionStore(),
+		Revocations:    NewMemoryRevocationStore(),
+		MFA:            NewMemoryMFAStore(),
+		Settings:       NewMemorySettingStore(),
+		ApiKeys:        NewMemoryApiKeyStore(),
+		Audit:          NewMemoryAuditStore(),
+		Identities:     NewMemoryIdentityStore(),
+		MagicLinks:     NewMemoryMagicLinkStore(),
+		PasswordResets: NewMemoryPasswordResetStore(),
+		Verifications:  NewMemoryVerificationStore(users),
+		Attempts:       utils.NewMemoryAttemptStore(),
+	}
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// VerificationStore keeps the tokens of the links which verify the email of a user
+type VerificationStore interface {
+	// Save stores a new verification token, older tokens of the user stay valid until they expire
+	Save(ctx context.Context, verification *customTypes.EmailVerification) error
+	/*
+		Verify marks the email of the token as verified, removes the user's open verifications and returns the user's ID.
+		Tokens for an email the user no longer has are rejected
+	*/
+	Verify(ctx context.Context, tokenHash string) (string, error)
+}
+
+// MemoryVerificationStore marks the emails as verified in the memory store of the users
+type MemoryVerificationStore struct {
+	mu            sync.Mutex
+	users         UserStore
+	verifications map[string]*customTypes.EmailVerification
+}
+
+func NewMemoryVerificationStore(users UserStore) *MemoryVerificationStore {
+	return &MemoryVerificationStore{users: users, verifications: make(map[string]*customTypes.EmailVerification)}
+}
+
+func (s *MemoryVerificationStore) Save(_ context.Context, verification *customTypes.EmailVerification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := *verification
+	s.verifications[verification.TokenHash] = &stored
+
+	return nil
+}
+
+func (s *MemoryVerificationStore) Verify(ctx context.Context, tokenHash string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	verification, exists := s.verifications[tokenHash]
+
+	if !exists {
+		return "", errors.New("invalid verification token")
+	}
+
+	now := time.Now().Unix()
+
+	if verification.ExpiresAt < now {
+		return "", errors.New("verification token expired")
+	}
+
+	err := s.users.MarkEmailVerified(ctx, verification.UserID, verification.Email)
+
+	if err != nil {
+		return "", err
+	}
+
+	usr, err := s.users.GetByID(ctx, verification.UserID)
+
+	if err != nil || usr.Email != NormalizeEmail(verification.Email) || !usr.EmailVerified {
+		return "", errors.New("email changed since the verification was sent")
+	}
+
+	for hash, other := range s.verifications {
+		if other.UserID == verification.UserID || other.ExpiresAt < now {
+			delete(s.verifications, hash)
+		}
+	}
+
+	return usr.ID.String(), nil
+}
@@ -1,6 +1,7 @@
 package customTypes
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -26,12 +27,13 @@ type RegisterUserRequest struct {
 }
 
 type User struct {
-	ID        uuid.UUID `json:"userId"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	Created   int       `json:"created"`
+	ID            uuid.UUID `json:"userId"`
+	FirstName     string    `json:"firstName"`
+	LastName      string    `json:"lastName"`
+	Email         string    `json:"email"`
+	Password      string    `json:"-"`
+	Created       int       `json:"created"`
+	EmailVerified bool      `json:"emailVerified"`
 }
 
 type LoginAdminRequest struct {
@@ -50,17 +52,31 @@ type Admin struct {
 	Email    string    `json:"email"`
 	Password string    `json:"-"`
 	Created  int       `json:"created"`
+	Roles    []string  `json:"roles,omitempty"`
 }
 
 type EditAdminRequest struct {
 	UserName string `json:"userName"`
 	Email    string `json:"email"`
+	// Roles stay untouched when they are missing in the request
+	Roles []string `json:"roles"`
 }
 
 type AddAdminRequest struct {
-	UserName string `json:"userName"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	UserName string   `json:"userName"`
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+type SetAdminRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
 }
 
 type DockerContainer struct {
@@ -97,16 +113,261 @@ type SearchAdminRequest struct {
 	Email    string `json:"email"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresAt    int64  `json:"expiresAt"`
+}
+
+type RefreshToken struct {
+	// TokenHash is the sha256 of the token, the token itself is never stored
+	TokenHash string
+	// FamilyID is the ID of the session all rotated tokens of a login belong to
+	FamilyID   string
+	PersonID   string
+	PersonType Person
+	ExpiresAt  int64
+	Created    int64
+	Revoked    bool
+}
+
+type AdminMFA struct {
+	AdminID      string
+	Secret       string
+	Enabled      bool
+	LastUsedStep int64
+	Created      int64
+}
+
+type MFACodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type MFAPolicyRequest struct {
+	Required bool `json:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+	// Type selects the account, users are the default
+	Type Person `json:"type"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token"`
+}
+
+type MagicLink struct {
+	TokenID   string
+	UserID    string
+	Email     string
+	ExpiresAt int64
+	Used      bool
+	Created   int64
+}
+
+type LoginMethodsRequest struct {
+	LoginMethods string `json:"loginMethods"`
+}
+
+// ways a user can log in
+const (
+	LoginMethodPassword  = "password"
+	LoginMethodMagicLink = "magic_link"
+	LoginMethodBoth      = "both"
+)
+
+// AuditEntry records a request an admin made while impersonating a user
+type AuditEntry struct {
+	ID          int64  `json:"id"`
+	ActorID     string `json:"actorId"`
+	ActorType   Person `json:"actorType"`
+	SubjectID   string `json:"subjectId"`
+	SubjectType Person `json:"subjectType"`
+	Action      string `json:"action"`
+	Status      int    `json:"status"`
+	IP          string `json:"ip"`
+	Created     int64  `json:"created"`
+}
+
+type PasswordReset struct {
+	TokenHash  string
+	PersonID   string
+	PersonType Person
+	ExpiresAt  int64
+	Used       bool
+	Created    int64
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type EmailVerification struct {
+	TokenHash string
+	UserID    string
+	Email     string
+	ExpiresAt int64
+	Created   int64
+}
+
+type Session struct {
+	ID         string `json:"sessionId"`
+	PersonID   string `json:"-"`
+	PersonType Person `json:"-"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
+	Created    int64  `json:"created"`
+	LastSeen   int64  `json:"lastSeen"`
+	ExpiresAt  int64  `json:"expiresAt"`
+	Revoked    bool   `json:"-"`
+	// Current marks the session of the request listing the sessions
+	Current bool `json:"current"`
+}
+
+// ApiKey is a credential for scripts and CI jobs, the key itself is only shown once when it is created
+type ApiKey struct {
+	ID   string `json:"keyId"`
+	Name string `json:"name"`
+	// Prefix is the visible part of the key, it identifies the key in lists and logs
+	Prefix    string   `json:"prefix"`
+	KeyHash   string   `json:"-"`
+	Scopes    []string `json:"scopes"`
+	CreatedBy string   `json:"createdBy"`
+	Created   int64    `json:"created"`
+	LastUsed  int64    `json:"lastUsed"`
+	Revoked   bool     `json:"revoked"`
+}
+
+type CreateApiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
 type Person int
 
 const (
 	USER Person = iota
 	ADMIN
+	// SERVICE is the principal type of requests authenticated with an api key
+	SERVICE
+)
+
+func (p Person) String() string {
+	switch p {
+	case USER:
+		return "user"
+	case ADMIN:
+		return "admin"
+	case SERVICE:
+		return "service"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText lets persons appear as "user", "admin" or "service" in JSON, e.g. in token claims
+func (p Person) MarshalText() ([]byte, error) {
+	if p != USER && p != ADMIN && p != SERVICE {
+		return nil, errors.New("invalid person type")
+	}
+
+	return []byte(p.String()), nil
+}
+
+func (p *Person) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "user":
+		*p = USER
+	case "admin":
+		*p = ADMIN
+	case "service":
+		*p = SERVICE
+	default:
+		return errors.New("invalid person type " + string(text))
+	}
+
+	return nil
+}
+
+// roles carried in the token of every principal
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// roles which can be assigned to admins, they are stored in the database
+const (
+	RoleSuperadmin = "superadmin"
+	RoleSupport    = "support"
+	RoleOps        = "ops"
+)
+
+// permissions granted to roles, routes are guarded by them
+const (
+	PermUsersRead   = "users:read"
+	PermUsersWrite  = "users:write"
+	PermUsersDelete = "users:delete"
+	PermAdminsRead  = "admins:read"
+	PermAdminsWrite = "admins:write"
+	PermDockerRead  = "docker:read"
+	// PermUsersImpersonate allows admins to act as a user, e.g. to debug a problem
+	PermUsersImpersonate = "users:impersonate"
 )
 
 type LoginAttemptInfo struct {
-	AttemptCount int
-	LastAttempt  time.Time
-	BlockedUntil time.Time
-	IpAttempts   map[string]int
+	AttemptCount int            `json:"attemptCount"`
+	LastAttempt  time.Time      `json:"lastAttempt"`
+	BlockedUntil time.Time      `json:"blockedUntil"`
+	IpAttempts   map[string]int `json:"ipAttempts"`
+}
+
+// Lockout is a tracked account ("account:<email>") or ip ("ip:<address>") with its failed logins
+type Lockout struct {
+	Key     string `json:"key"`
+	Blocked bool   `json:"blocked"`
+	LoginAttemptInfo
+}
+
+// Migration is a versioned schema change, the checksum is the sha256 of the up script
+type Migration struct {
+	Version  int    `json:"version"`
+	Name     string `json:"name"`
+	Up       string `json:"-"`
+	Down     string `json:"-"`
+	Checksum string `json:"checksum"`
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool  `json:"applied"`
+	AppliedAt int64 `json:"appliedAt"`
 }
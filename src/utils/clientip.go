@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// IPResolver finds the address of the client, forwarding headers are only trusted from configured proxies
+type IPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewIPResolver accepts CIDRs like "10.0.0.0/8" or single addresses
+func NewIPResolver(proxies []string) (*IPResolver, error) {
+	resolver := &IPResolver{}
+
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+
+		if proxy == "" {
+			continue
+		}
+
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+
+		if err != nil {
+			return nil, errors.New("invalid trusted proxy " + proxy + ": " + err.Error())
+		}
+
+		resolver.trusted = append(resolver.trusted, network)
+	}
+
+	return resolver, nil
+}
+
+// IPResolverFromEnv reads the comma separated TRUSTED_PROXIES
+func IPResolverFromEnv() (*IPResolver, error) {
+	return NewIPResolver(strings.Split(os.Getenv("TRUSTED_PROXIES"), ","))
+}
+
+func (r *IPResolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ClientIP returns the address of the client without port.
+If the request came from a trusted proxy, the forwarding chain (Forwarded or X-Forwarded-For)
+is walked from the right and the first address which isn't a trusted proxy is the client
+*/
+func (r *IPResolver) ClientIP(request *http.Request) string {
+	remote := StripPort(request.RemoteAddr)
+	remoteIP := net.ParseIP(remote)
+
+	if remoteIP == nil || !r.isTrusted(remoteIP) {
+		return remote
+	}
+
+	chain := forwardedChain(request)
+
+	client := remote
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(chain[i])
+
+		// obfuscated or broken entries can't be followed, the last known hop is used
+		if ip == nil {
+			return client
+		}
+
+		client = ip.String()
+
+		if !r.isTrusted(ip) {
+			return client
+		}
+	}
+
+	return client
+}
+
+// forwardedChain returns the addresses of the Forwarded header, or of X-Forwarded-For if it is missing
+func forwardedChain(request *http.Request) []string {
+	var chain []string
+
+	for _, header := range request.Header.Values("Forwarded") {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+
+				if found && strings.EqualFold(name, "for") {
+					chain = append(chain, StripPort(strings.Trim(value, `"`)))
+				}
+			}
+		}
+	}
+
+	if len(chain) > 0 {
+		return chain
+	}
+
+	for _, header := range request.Header.Values("X-Forwarded-For") {
+		for _, address := range strings.Split(header, ",") {
+			chain = append(chain, StripPort(strings.TrimSpace(address)))
+		}
+	}
+
+	return chain
+}
+
+// StripPort removes the port from "1.2.3.4:5678" or "[::1]:5678", addresses without port stay the same
+func StripPort(address string) string {
+	host, _, err := net.SplitHostPort(address)
+
+	if err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+}
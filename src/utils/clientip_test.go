@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	resolver, err := NewIPResolver([]string{"10.0.0.0/8", " 192.168.1.1", "", "::1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		xff       []string
+		client    string
+	}{
+		{name: "untrusted remote without headers", remote: "203.0.113.5:1234", client: "203.0.113.5"},
+		{name: "untrusted remote can't spoof x-forwarded-for", remote: "203.0.113.5:1234", xff: []string{"1.2.3.4"}, client: "203.0.113.5"},
+		{name: "untrusted remote can't spoof forwarded", remote: "203.0.113.5:1234", forwarded: []string{"for=1.2.3.4"}, client: "203.0.113.5"},
+		{name: "address next to a trusted single proxy isn't trusted", remote: "192.168.1.2:1234", xff: []string{"1.2.3.4"}, client: "192.168.1.2"},
+		{name: "trusted remote without headers", remote: "10.0.0.1:1234", client: "10.0.0.1"},
+		{name: "trusted remote", remote: "10.0.0.1:1234", xff: []string{"198.51.100.7"}, client: "198.51.100.7"},
+		{name: "trusted single proxy", remote: "192.168.1.1:1234", xff: []string{"198.51.100.7"}, client: "198.51.100.7"},
+		{name: "trusted ipv6 remote", remote: "[::1]:1234", xff: []string{"198.51.100.7"}, client: "198.51.100.7"},
+		{name: "spoofed entries left of the client are ignored", remote: "10.0.0.1:1234", xff: []string{"1.2.3.4, 198.51.100.7, 10.0.0.2"}, client: "198.51.100.7"},
+		{name: "chain over several headers", remote: "10.0.0.1:1234", xff: []string{"1.2.3.4", "198.51.100.7"}, client: "198.51.100.7"},
+		{name: "chain of trusted proxies only", remote: "10.0.0.1:1234", xff: []string{"10.0.0.3, 10.0.0.2"}, client: "10.0.0.3"},
+		{name: "forwarded wins over x-forwarded-for", remote: "10.0.0.1:1234", forwarded: []string{"for=198.51.100.9;proto=https, for=10.0.0.2"}, xff: []string{"6.6.6.6"}, client: "198.51.100.9"},
+		{name: "quoted ipv6 with port in forwarded", remote: "10.0.0.1:1234", forwarded: []string{`For="[2001:db8::1]:4711"`}, client: "2001:db8::1"},
+		{name: "obfuscated hop stops at the last known address", remote: "10.0.0.1:1234", forwarded: []string{"for=198.51.100.9, for=_hidden"}, client: "10.0.0.1"},
+		{name: "broken entry behind a trusted proxy", remote: "10.0.0.1:1234", xff: []string{"198.51.100.7, garbage, 10.0.0.2"}, client: "10.0.0.2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/", nil)
+			request.RemoteAddr = test.remote
+
+			for _, value := range test.forwarded {
+				request.Header.Add("Forwarded", value)
+			}
+
+			for _, value := range test.xff {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+
+			client := resolver.ClientIP(request)
+
+			if client != test.client {
+				t.Errorf("got %s, want %s", client, test.client)
+			}
+		})
+	}
+}
+
+func TestNewIPResolverRejectsInvalidProxies(t *testing.T) {
+	for _, proxy := range []string{"not-an-ip", "10.0.0.0/33", "10.0.0.1/8/1"} {
+		_, err := NewIPResolver([]string{proxy})
+
+		if err == nil {
+			t.Errorf("proxy %q: got no error", proxy)
+		}
+	}
+}
+
+func TestStripPort(t *testing.T) {
+	tests := map[string]string{
+		"1.2.3.4:5678":   "1.2.3.4",
+		"1.2.3.4":        "1.2.3.4",
+		"[::1]:5678":     "::1",
+		"[2001:db8::1]":  "2001:db8::1",
+		"2001:db8::1":    "2001:db8::1",
+		"proxy.internal": "proxy.internal",
+	}
+
+	for address, want := range tests {
+		got := StripPort(address)
+
+		if got != want {
+			t.Errorf("StripPort(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
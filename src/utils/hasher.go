@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher creates password hashes with the configured algorithm and cost
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// NeedsRehash reports if the hash was created with another algorithm or cost
+	NeedsRehash(hash string) bool
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+
+	if err != nil {
+		return "", errors.New("couldn't hash password: " + err.Error())
+	}
+
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher creates hashes in the PHC string format, e.g. $argon2id$v=19$m=65536,t=3,p=2$salt$hash
+type Argon2idHasher struct {
+	// Memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+
+	_, err := rand.Read(salt)
+
+	if err != nil {
+		return "", errors.New("couldn't generate salt: " + err.Error())
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, err := parseArgon2id(hash)
+
+	if err != nil {
+		return true
+	}
+
+	return params.memory != h.Memory || params.iterations != h.Iterations || params.parallelism != h.Parallelism || uint32(len(params.key)) != h.KeyLength
+}
+
+func parseArgon2id(hash string) (*argon2idParams, error) {
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+
+	if err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2 version")
+	}
+
+	var params argon2idParams
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+
+	if err != nil {
+		return nil, errors.New("invalid argon2id parameters: " + err.Error())
+	}
+
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return nil, errors.New("invalid argon2id salt: " + err.Error())
+	}
+
+	params.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil {
+		return nil, errors.New("invalid argon2id hash: " + err.Error())
+	}
+
+	return &params, nil
+}
+
+// VerifyPassword compares the password with a bcrypt or argon2id hash, independent of the configured algorithm
+func VerifyPassword(hash, password string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, err := parseArgon2id(hash)
+
+		if err != nil {
+			return false
+		}
+
+		key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+
+		return subtle.ConstantTimeCompare(key, params.key) == 1
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+/*
+PasswordHasherFromEnv reads PASSWORD_HASH_ALGORITHM (bcrypt or argon2id), PASSWORD_BCRYPT_COST (12)
+and ARGON2_MEMORY (65536 KiB), ARGON2_ITERATIONS (3), ARGON2_PARALLELISM (2)
+*/
+func PasswordHasherFromEnv() (PasswordHasher, error) {
+	switch os.Getenv("PASSWORD_HASH_ALGORITHM") {
+	case "", "bcrypt":
+		cost := GetEnvInt("PASSWORD_BCRYPT_COST", 12)
+
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("PASSWORD_BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+
+		return &BcryptHasher{Cost: cost}, nil
+	case "argon2id":
+		parallelism := GetEnvInt("ARGON2_PARALLELISM", 2)
+
+		if parallelism < 1 || parallelism > 255 {
+			return nil, errors.New("ARGON2_PARALLELISM must be between 1 and 255")
+		}
+
+		memory := GetEnvInt("ARGON2_MEMORY", 64*1024)
+		iterations := GetEnvInt("ARGON2_ITERATIONS", 3)
+
+		if iterations < 1 || memory < 8*parallelism {
+			return nil, errors.New("ARGON2_ITERATIONS must be at least 1 and ARGON2_MEMORY at least 8 KiB per thread")
+		}
+
+		return &Argon2idHasher{
+			Memory:      uint32(memory),
+			Iterations:  uint32(iterations),
+			Parallelism: uint8(parallelism),
+			SaltLength:  16,
+			KeyLength:   32,
+		}, nil
+	default:
+		return nil, errors.New("unknown PASSWORD_HASH_ALGORITHM " + os.Getenv("PASSWORD_HASH_ALGORITHM"))
+	}
+}
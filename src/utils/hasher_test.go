@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// cheap parameters, the tests only check the format and the comparison
+func testArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+}
+
+func TestPasswordHashers(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		prefix string
+	}{
+		{name: "bcrypt", hasher: &BcryptHasher{Cost: 4}, prefix: "$2a$04$"},
+		{name: "argon2id", hasher: testArgon2idHasher(), prefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hash, err := test.hasher.Hash("Correct-Horse-7")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(hash, test.prefix) {
+				t.Errorf("got hash %s, want prefix %s", hash, test.prefix)
+			}
+
+			if !VerifyPassword(hash, "Correct-Horse-7") {
+				t.Error("correct password was rejected")
+			}
+
+			if VerifyPassword(hash, "Correct-Horse-8") {
+				t.Error("wrong password was accepted")
+			}
+
+			other, err := test.hasher.Hash("Correct-Horse-7")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if other == hash {
+				t.Error("two hashes of the password are equal, the salt is missing")
+			}
+
+			if test.hasher.NeedsRehash(hash) {
+				t.Error("hash of the hasher itself needs a rehash")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	bcryptHash, err := (&BcryptHasher{Cost: 4}).Hash("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	argon2idHash, err := testArgon2idHasher().Hash("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moreMemory := testArgon2idHasher()
+	moreMemory.Memory = 128
+
+	longerKey := testArgon2idHasher()
+	longerKey.KeyLength = 64
+
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		rehash bool
+	}{
+		{name: "bcrypt with the same cost", hasher: &BcryptHasher{Cost: 4}, hash: bcryptHash},
+		{name: "bcrypt with a higher cost", hasher: &BcryptHasher{Cost: 5}, hash: bcryptHash, rehash: true},
+		{name: "argon2id hash under bcrypt", hasher: &BcryptHasher{Cost: 4}, hash: argon2idHash, rehash: true},
+		{name: "bcrypt hash under argon2id", hasher: testArgon2idHasher(), hash: bcryptHash, rehash: true},
+		{name: "argon2id with the same parameters", hasher: testArgon2idHasher(), hash: argon2idHash},
+		{name: "argon2id with more memory", hasher: moreMemory, hash: argon2idHash, rehash: true},
+		{name: "argon2id with a longer key", hasher: longerKey, hash: argon2idHash, rehash: true},
+		{name: "malformed argon2id hash", hasher: testArgon2idHasher(), hash: "$argon2id$v=19$m=64", rehash: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if rehash := test.hasher.NeedsRehash(test.hash); rehash != test.rehash {
+				t.Errorf("got rehash %t, want %t", rehash, test.rehash)
+			}
+		})
+	}
+}
+
+// a bcrypt hash keeps working after switching to argon2id and is replaced at the next login
+func TestRehashBcryptToArgon2id(t *testing.T) {
+	hash, err := (&BcryptHasher{Cost: 4}).Hash("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher := testArgon2idHasher()
+
+	if !VerifyPassword(hash, "Correct-Horse-7") || !hasher.NeedsRehash(hash) {
+		t.Fatal("bcrypt hash must verify and need a rehash under argon2id")
+	}
+
+	hash, err = hasher.Hash("Correct-Horse-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !VerifyPassword(hash, "Correct-Horse-7") || hasher.NeedsRehash(hash) {
+		t.Error("argon2id hash must verify and not need another rehash")
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+	} {
+		if VerifyPassword(hash, "plaintext") {
+			t.Errorf("hash %q was accepted", hash)
+		}
+	}
+}
+
+func TestPasswordHasherFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		algorithm string
+		fails     bool
+	}{
+		{name: "default", algorithm: "bcrypt"},
+		{name: "bcrypt", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "bcrypt", "PASSWORD_BCRYPT_COST": "10"}, algorithm: "bcrypt"},
+		{name: "bcrypt cost too low", env: map[string]string{"PASSWORD_BCRYPT_COST": "3"}, fails: true},
+		{name: "bcrypt cost too high", env: map[string]string{"PASSWORD_BCRYPT_COST": "32"}, fails: true},
+		{name: "argon2id", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id"}, algorithm: "argon2id"},
+		{name: "argon2id parallelism out of range", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "ARGON2_PARALLELISM": "256"}, fails: true},
+		{name: "argon2id memory too low", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "ARGON2_MEMORY": "15", "ARGON2_PARALLELISM": "2"}, fails: true},
+		{name: "argon2id without iterations", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "argon2id", "ARGON2_ITERATIONS": "0"}, fails: true},
+		{name: "unknown algorithm", env: map[string]string{"PASSWORD_HASH_ALGORITHM": "md5"}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"PASSWORD_HASH_ALGORITHM", "PASSWORD_BCRYPT_COST", "ARGON2_MEMORY", "ARGON2_ITERATIONS", "ARGON2_PARALLELISM"} {
+				t.Setenv(key, test.env[key])
+			}
+
+			hasher, err := PasswordHasherFromEnv()
+
+			if test.fails {
+				if err == nil {
+					t.Errorf("got hasher %+v, want an error", hasher)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			switch hasher.(type) {
+			case *BcryptHasher:
+				if test.algorithm != "bcrypt" {
+					t.Errorf("got bcrypt, want %s", test.algorithm)
+				}
+			case *Argon2idHasher:
+				if test.algorithm != "argon2id" {
+					t.Errorf("got argon2id, want %s", test.algorithm)
+				}
+			}
+		})
+	}
+}
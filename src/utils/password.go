@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcrypt ignores everything after 72 bytes, longer passwords would only look stronger than they are
+const bcryptMaxPasswordLength = 72
+
+// PasswordPolicy are the rules new passwords are checked against
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	ForbidEmail   bool
+	// BreachedDir contains files named after the first 5 hex chars of a SHA-1 hash with
+	// one "SUFFIX" or "SUFFIX:COUNT" line per breached password, like the Pwned Passwords range files
+	BreachedDir string
+}
+
+// PasswordPolicyError lists every rule the password broke
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password must " + strings.Join(e.Violations, ", must ")
+}
+
+/*
+PasswordPolicyFromEnv reads PASSWORD_MIN_LENGTH (10), PASSWORD_MAX_LENGTH (72), PASSWORD_REQUIRE_UPPER,
+PASSWORD_REQUIRE_LOWER, PASSWORD_REQUIRE_DIGIT (all true), PASSWORD_REQUIRE_SYMBOL (false)
+and PASSWORD_BREACHED_DIR
+*/
+func PasswordPolicyFromEnv() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:     GetEnvInt("PASSWORD_MIN_LENGTH", 10),
+		MaxLength:     GetEnvInt("PASSWORD_MAX_LENGTH", bcryptMaxPasswordLength),
+		RequireUpper:  GetEnvBool("PASSWORD_REQUIRE_UPPER", true),
+		RequireLower:  GetEnvBool("PASSWORD_REQUIRE_LOWER", true),
+		RequireDigit:  GetEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol: GetEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+		ForbidEmail:   true,
+		BreachedDir:   os.Getenv("PASSWORD_BREACHED_DIR"),
+	}
+
+	if policy.MaxLength <= 0 || policy.MaxLength > bcryptMaxPasswordLength {
+		policy.MaxLength = bcryptMaxPasswordLength
+	}
+
+	return policy
+}
+
+// Validate checks the password of the account with the email, the error is a *PasswordPolicyError if rules failed
+func (p PasswordPolicy) Validate(password, email string) error {
+	violations := []string{}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, "be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+
+	if len(password) > p.MaxLength {
+		violations = append(violations, "be at most "+strconv.Itoa(p.MaxLength)+" bytes long")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+
+	for _, char := range password {
+		switch {
+		case unicode.IsUpper(char):
+			hasUpper = true
+		case unicode.IsLower(char):
+			hasLower = true
+		case unicode.IsDigit(char):
+			hasDigit = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char) || unicode.IsSpace(char):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, "contain an uppercase letter")
+	}
+
+	if p.RequireLower && !hasLower {
+		violations = append(violations, "contain a lowercase letter")
+	}
+
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, "contain a digit")
+	}
+
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, "contain a symbol")
+	}
+
+	if p.ForbidEmail && containsEmail(password, email) {
+		violations = append(violations, "not contain the email address")
+	}
+
+	if p.BreachedDir != "" {
+		breached, err := isBreachedPassword(p.BreachedDir, password)
+
+		if err != nil {
+			return err
+		}
+
+		if breached {
+			violations = append(violations, "not be part of a known data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// containsEmail checks the whole address and its local part, short local parts would match too many passwords
+func containsEmail(password, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	if email == "" {
+		return false
+	}
+
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	localPart, _, _ := strings.Cut(email, "@")
+
+	return len(localPart) >= 3 && strings.Contains(password, localPart)
+}
+
+// isBreachedPassword looks the SHA-1 of the password up in the range file of its prefix, it works offline
+func isBreachedPassword(dir, password string) (bool, error) {
+	hash := sha1.Sum([]byte(password))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+	prefix, suffix := hexHash[:5], hexHash[5:]
+
+	file, err := os.Open(filepath.Join(dir, prefix+".txt"))
+
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(filepath.Join(dir, prefix))
+	}
+
+	// no file for the prefix means no breached password starts with it
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errors.New("unable to read breached passwords: " + err.Error())
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return false, errors.New("unable to read breached passwords: " + err.Error())
+	}
+
+	return false, nil
+}
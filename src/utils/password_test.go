@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:    10,
+		MaxLength:    20,
+		RequireUpper: true,
+		RequireLower: true,
+		RequireDigit: true,
+		ForbidEmail:  true,
+	}
+
+	tests := []struct {
+		name       string
+		policy     PasswordPolicy
+		password   string
+		email      string
+		violations []string
+	}{
+		{name: "valid", policy: policy, password: "Correct-Horse-7", email: "ada@example.com"},
+		{name: "too short", policy: policy, password: "Short-7a", email: "ada@example.com", violations: []string{"be at least 10 characters long"}},
+		{name: "length counts characters", policy: policy, password: "Äöüäöüäöü1", email: "ada@example.com"},
+		{name: "too long", policy: policy, password: "Correct-Horse-Battery-7", email: "ada@example.com", violations: []string{"be at most 20 bytes long"}},
+		{name: "missing classes", policy: policy, password: "correcthorse", email: "ada@example.com", violations: []string{"contain an uppercase letter", "contain a digit"}},
+		{name: "symbol required", policy: PasswordPolicy{MinLength: 1, MaxLength: 72, RequireSymbol: true}, password: "CorrectHorse7", violations: []string{"contain a symbol"}},
+		{name: "space counts as symbol", policy: PasswordPolicy{MinLength: 1, MaxLength: 72, RequireSymbol: true}, password: "Correct Horse 7"},
+		{name: "contains the email", policy: policy, password: "X1Ada@Example.com", email: " ada@example.com", violations: []string{"not contain the email address"}},
+		{name: "contains the local part", policy: policy, password: "Grace-Hopper-1", email: "grace@example.com", violations: []string{"not contain the email address"}},
+		{name: "short local parts are allowed", policy: policy, password: "Jo-Correct-7", email: "jo@example.com"},
+		{name: "email allowed by the policy", policy: PasswordPolicy{MinLength: 1, MaxLength: 72}, password: "grace@example.com", email: "grace@example.com"},
+		{name: "every violation is listed", policy: policy, password: "ada", email: "ada@example.com", violations: []string{"be at least 10 characters long", "contain an uppercase letter", "contain a digit", "not contain the email address"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.policy.Validate(test.password, test.email)
+
+			if test.violations == nil {
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+				return
+			}
+
+			var policyErr *PasswordPolicyError
+
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("got %v, want a *PasswordPolicyError", err)
+			}
+
+			if !slices.Equal(policyErr.Violations, test.violations) {
+				t.Errorf("got violations %q, want %q", policyErr.Violations, test.violations)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyBreachedPasswords(t *testing.T) {
+	dir := t.TempDir()
+
+	hash := sha1.Sum([]byte("Correct-Horse-7"))
+	hexHash := strings.ToUpper(hex.EncodeToString(hash[:]))
+
+	// range files may or may not have the .txt extension, suffixes may be lower case and have a count
+	err := os.WriteFile(filepath.Join(dir, hexHash[:5]+".txt"), []byte("0000000000000000000000000000000000A:3\r\n"+strings.ToLower(hexHash[5:])+":12\r\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := sha1.Sum([]byte("Battery-Staple-9"))
+	otherHex := strings.ToUpper(hex.EncodeToString(other[:]))
+
+	err = os.WriteFile(filepath.Join(dir, otherHex[:5]), []byte(otherHex[5:]+"\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := PasswordPolicy{MinLength: 1, MaxLength: 72, BreachedDir: dir}
+
+	tests := []struct {
+		password string
+		breached bool
+	}{
+		{password: "Correct-Horse-7", breached: true},
+		{password: "Battery-Staple-9", breached: true},
+		{password: "Unlisted-Password-3"},
+	}
+
+	for _, test := range tests {
+		err := policy.Validate(test.password, "")
+
+		var policyErr *PasswordPolicyError
+
+		if errors.As(err, &policyErr) != test.breached {
+			t.Errorf("%s: got %v, want breached %t", test.password, err, test.breached)
+		}
+	}
+}
+
+func TestPasswordPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength string
+		want      int
+	}{
+		{name: "default", want: 72},
+		{name: "shorter", maxLength: "64", want: 64},
+		{name: "longer than bcrypt hashes", maxLength: "128", want: 72},
+		{name: "invalid", maxLength: "0", want: 72},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, key := range []string{"PASSWORD_MIN_LENGTH", "PASSWORD_REQUIRE_UPPER", "PASSWORD_REQUIRE_LOWER", "PASSWORD_REQUIRE_DIGIT", "PASSWORD_REQUIRE_SYMBOL"} {
+				t.Setenv(key, "")
+			}
+
+			t.Setenv("PASSWORD_MAX_LENGTH", test.maxLength)
+
+			policy := PasswordPolicyFromEnv()
+
+			if policy.MaxLength != test.want {
+				t.Errorf("got max length %d, want %d", policy.MaxLength, test.want)
+			}
+
+			if policy.MinLength != 10 || !policy.RequireUpper || !policy.RequireLower || !policy.RequireDigit || policy.RequireSymbol || !policy.ForbidEmail {
+				t.Errorf("got policy %+v, want the defaults", policy)
+			}
+		})
+	}
+}
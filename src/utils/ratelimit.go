@@ -0,0 +1,275 @@
+package utils
+
+import (
+	customTypes "backend/src/types"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttemptStore persists login attempts, keys look like "account:<email>" or "ip:<address>"
+type AttemptStore interface {
+	// Get returns nil if there were no attempts for the key
+	Get(ctx context.Context, key string) (*customTypes.LoginAttemptInfo, error)
+	/*
+		Increment atomically counts a failure of the key from the ip and returns the new counts.
+		The counts start over if neither the last attempt nor the block are after windowStart
+	*/
+	Increment(ctx context.Context, key, ip string, now, windowStart time.Time) (*customTypes.LoginAttemptInfo, error)
+	// Block blocks the key until the time, a block which lasts longer already is kept
+	Block(ctx context.Context, key string, until time.Time) error
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context) (map[string]*customTypes.LoginAttemptInfo, error)
+	// DeleteOlderThan removes entries whose last attempt and block are older than the time
+	DeleteOlderThan(ctx context.Context, before time.Time) error
+}
+
+// RateLimiter throttles logins per account and per ip
+type RateLimiter interface {
+	// Check returns how long the account or ip is still blocked, zero means the login may be tried
+	Check(ctx context.Context, account, ip string) (time.Duration, error)
+	// Fail records a failed login and returns how long the account or ip is blocked now
+	Fail(ctx context.Context, account, ip string) (time.Duration, error)
+	// Succeed forgets the failed logins of the account
+	Succeed(ctx context.Context, account, ip string) error
+}
+
+type RateLimitConfig struct {
+	// failed logins of an account before it gets blocked
+	MaxAttempts int
+	// failed logins from one ip before it gets blocked
+	MaxAttemptsPerIP int
+	// failures are forgotten after this time without attempts
+	Window time.Duration
+	// duration of the first block, it doubles with every further failure
+	BlockDuration    time.Duration
+	MaxBlockDuration time.Duration
+}
+
+// RateLimitConfigFromEnv reads the thresholds from the environment
+func RateLimitConfigFromEnv() RateLimitConfig {
+	return RateLimitConfig{
+		MaxAttempts:      GetEnvInt("LOGIN_MAX_ATTEMPTS", 10),
+		MaxAttemptsPerIP: GetEnvInt("LOGIN_MAX_ATTEMPTS_PER_IP", 10),
+		Window:           GetEnvDuration("LOGIN_ATTEMPT_WINDOW", time.Minute),
+		BlockDuration:    GetEnvDuration("LOGIN_BLOCK_DURATION", time.Minute),
+		MaxBlockDuration: GetEnvDuration("LOGIN_MAX_BLOCK_DURATION", time.Hour),
+	}
+}
+
+const cleanupInterval = 1 * time.Minute // interval for cleanup of expired entries
+
+func AccountKey(account string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(account))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+type loginLimiter struct {
+	store       AttemptStore
+	config      RateLimitConfig
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewLoginLimiter(store AttemptStore, config RateLimitConfig) RateLimiter {
+	return &loginLimiter{store: store, config: config, lastCleanup: time.Now()}
+}
+
+func (l *loginLimiter) Check(ctx context.Context, account, ip string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	return l.blockedFor(ctx, now, AccountKey(account), IPKey(ip))
+}
+
+func (l *loginLimiter) blockedFor(ctx context.Context, now time.Time, keys ...string) (time.Duration, error) {
+	var wait time.Duration
+
+	for _, key := range keys {
+		info, err := l.store.Get(ctx, key)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if info != nil && info.BlockedUntil.After(now) && info.BlockedUntil.Sub(now) > wait {
+			wait = info.BlockedUntil.Sub(now)
+		}
+	}
+
+	return wait, nil
+}
+
+func (l *loginLimiter) Fail(ctx context.Context, account, ip string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(l.lastCleanup) > cleanupInterval {
+		err := l.store.DeleteOlderThan(ctx, now.Add(-l.config.Window))
+
+		if err != nil {
+			return 0, err
+		}
+
+		l.lastCleanup = now
+	}
+
+	err := l.record(ctx, now, AccountKey(account), ip, l.config.MaxAttempts)
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = l.record(ctx, now, IPKey(ip), ip, l.config.MaxAttemptsPerIP)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return l.blockedFor(ctx, now, AccountKey(account), IPKey(ip))
+}
+
+// record counts a failure for the key and blocks it with exponential back-off once the threshold is reached
+func (l *loginLimiter) record(ctx context.Context, now time.Time, key, ip string, maxAttempts int) error {
+	info, err := l.store.Increment(ctx, key, ip, now, now.Add(-l.config.Window))
+
+	if err != nil {
+		return err
+	}
+
+	if info.AttemptCount < maxAttempts {
+		return nil
+	}
+
+	return l.store.Block(ctx, key, now.Add(l.backoff(info.AttemptCount-maxAttempts)))
+}
+
+func (l *loginLimiter) backoff(exceeded int) time.Duration {
+	duration := l.config.BlockDuration
+
+	for i := 0; i < exceeded && duration < l.config.MaxBlockDuration; i++ {
+		duration *= 2
+	}
+
+	if duration > l.config.MaxBlockDuration {
+		return l.config.MaxBlockDuration
+	}
+
+	return duration
+}
+
+// Succeed only resets the account, failures of the ip keep counting against other accounts
+func (l *loginLimiter) Succeed(ctx context.Context, account, _ string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.store.Delete(ctx, AccountKey(account))
+}
+
+// MemoryAttemptStore keeps attempts in memory, they are lost on restart and not shared between replicas
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]*customTypes.LoginAttemptInfo
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{attempts: make(map[string]*customTypes.LoginAttemptInfo)}
+}
+
+func (s *MemoryAttemptStore) Get(_ context.Context, key string) (*customTypes.LoginAttemptInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.attempts[key]
+
+	if !exists {
+		return nil, nil
+	}
+
+	return copyAttemptInfo(info), nil
+}
+
+func (s *MemoryAttemptStore) Increment(_ context.Context, key, ip string, now, windowStart time.Time) (*customTypes.LoginAttemptInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.attempts[key]
+
+	if !exists || (info.LastAttempt.Before(windowStart) && info.BlockedUntil.Before(windowStart)) {
+		info = &customTypes.LoginAttemptInfo{IpAttempts: make(map[string]int)}
+		s.attempts[key] = info
+	}
+
+	info.AttemptCount++
+	info.LastAttempt = now
+	info.IpAttempts[ip]++
+
+	return copyAttemptInfo(info), nil
+}
+
+func (s *MemoryAttemptStore) Block(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, exists := s.attempts[key]
+
+	if exists && info.BlockedUntil.Before(until) {
+		info.BlockedUntil = until
+	}
+
+	return nil
+}
+
+func (s *MemoryAttemptStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+func (s *MemoryAttemptStore) List(_ context.Context) (map[string]*customTypes.LoginAttemptInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make(map[string]*customTypes.LoginAttemptInfo, len(s.attempts))
+	for key, info := range s.attempts {
+		list[key] = copyAttemptInfo(info)
+	}
+
+	return list, nil
+}
+
+func (s *MemoryAttemptStore) DeleteOlderThan(_ context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, info := range s.attempts {
+		if info.LastAttempt.Before(before) && info.BlockedUntil.Before(before) {
+			delete(s.attempts, key)
+		}
+	}
+
+	return nil
+}
+
+// copyAttemptInfo prevents callers from changing stored entries
+func copyAttemptInfo(info *customTypes.LoginAttemptInfo) *customTypes.LoginAttemptInfo {
+	copied := *info
+	copied.IpAttempts = make(map[string]int, len(info.IpAttempts))
+
+	for ip, count := range info.IpAttempts {
+		copied.IpAttempts[ip] = count
+	}
+
+	return &copied
+}
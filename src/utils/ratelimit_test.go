@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		MaxAttempts:      3,
+		MaxAttemptsPerIP: 5,
+		Window:           time.Minute,
+		BlockDuration:    time.Minute,
+		MaxBlockDuration: 10 * time.Minute,
+	}
+}
+
+func TestLoginLimiterThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		accounts int
+		failures int
+		blocked  bool
+	}{
+		{name: "account below threshold", accounts: 1, failures: 2},
+		{name: "account at threshold", accounts: 1, failures: 3, blocked: true},
+		{name: "ip below threshold", accounts: 4, failures: 1},
+		{name: "ip at threshold", accounts: 5, failures: 1, blocked: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			limiter := NewLoginLimiter(NewMemoryAttemptStore(), testRateLimitConfig())
+
+			var wait time.Duration
+			var err error
+
+			for account := 0; account < test.accounts; account++ {
+				for i := 0; i < test.failures; i++ {
+					wait, err = limiter.Fail(ctx, fmt.Sprintf("user%d@example.com", account), "198.51.100.7")
+
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			if (wait > 0) != test.blocked {
+				t.Errorf("Fail returned wait %s, want blocked %t", wait, test.blocked)
+			}
+
+			// the ip is checked for any account, the account from any ip
+			for _, check := range [][2]string{{"user0@example.com", "203.0.113.9"}, {"new@example.com", "198.51.100.7"}} {
+				wait, err = limiter.Check(ctx, check[0], check[1])
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				accountBlocked := check[0] == "user0@example.com" && test.failures >= 3
+				ipBlocked := check[1] == "198.51.100.7" && test.accounts*test.failures >= 5
+
+				if (wait > 0) != (accountBlocked || ipBlocked) {
+					t.Errorf("Check(%s, %s) returned wait %s, want blocked %t", check[0], check[1], wait, accountBlocked || ipBlocked)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginLimiterBackoff(t *testing.T) {
+	limiter := &loginLimiter{config: testRateLimitConfig()}
+
+	tests := []struct {
+		exceeded int
+		duration time.Duration
+	}{
+		{exceeded: 0, duration: time.Minute},
+		{exceeded: 1, duration: 2 * time.Minute},
+		{exceeded: 2, duration: 4 * time.Minute},
+		{exceeded: 3, duration: 8 * time.Minute},
+		{exceeded: 4, duration: 10 * time.Minute},
+		{exceeded: 100, duration: 10 * time.Minute},
+	}
+
+	for _, test := range tests {
+		duration := limiter.backoff(test.exceeded)
+
+		if duration != test.duration {
+			t.Errorf("backoff(%d) = %s, want %s", test.exceeded, duration, test.duration)
+		}
+	}
+}
+
+func TestLoginLimiterBlockGrowsWithFailures(t *testing.T) {
+	ctx := context.Background()
+	limiter := NewLoginLimiter(NewMemoryAttemptStore(), testRateLimitConfig())
+
+	want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute}
+
+	for i, duration := range want {
+		wait, err := limiter.Fail(ctx, "ada@example.com", fmt.Sprintf("198.51.100.%d", i))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the block started a moment before Fail returned
+		if wait > duration || wait < duration-time.Second {
+			t.Errorf("failure %d: got wait %s, want %s", i+1, wait, duration)
+		}
+	}
+}
+
+func TestLoginLimiterReset(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAttemptStore()
+	limiter := NewLoginLimiter(store, testRateLimitConfig())
+
+	for i := 0; i < 3; i++ {
+		_, err := limiter.Fail(ctx, " Ada@Example.com", "198.51.100.7")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := limiter.Succeed(ctx, "ada@example.com ", "198.51.100.7")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, _ := store.Get(ctx, AccountKey("ada@example.com"))
+
+	if account != nil {
+		t.Errorf("got attempts %+v of the account after the successful login, want none", account)
+	}
+
+	// failures of the ip keep counting, otherwise an attacker could reset them with an own account
+	ip, _ := store.Get(ctx, IPKey("198.51.100.7"))
+
+	if ip == nil || ip.AttemptCount != 3 {
+		t.Errorf("got attempts %+v of the ip, want 3", ip)
+	}
+}
+
+func TestMemoryAttemptStoreIncrement(t *testing.T) {
+	ctx := context.Background()
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name         string
+		lastAttempt  time.Time
+		blockedUntil time.Time
+		now          time.Time
+		count        int
+	}{
+		{name: "within the window", lastAttempt: start, now: start.Add(30 * time.Second), count: 3},
+		{name: "after the window", lastAttempt: start, now: start.Add(2 * time.Minute), count: 1},
+		{name: "blocked past the window", lastAttempt: start, blockedUntil: start.Add(5 * time.Minute), now: start.Add(2 * time.Minute), count: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryAttemptStore()
+
+			for i := 0; i < 2; i++ {
+				_, err := store.Increment(ctx, "account:ada@example.com", "198.51.100.7", test.lastAttempt, test.lastAttempt.Add(-time.Minute))
+
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := store.Block(ctx, "account:ada@example.com", test.blockedUntil)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := store.Increment(ctx, "account:ada@example.com", "198.51.100.7", test.now, test.now.Add(-time.Minute))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if info.AttemptCount != test.count || info.IpAttempts["198.51.100.7"] != test.count {
+				t.Errorf("got %d attempts, %d of the ip, want %d", info.AttemptCount, info.IpAttempts["198.51.100.7"], test.count)
+			}
+		})
+	}
+}
+
+func TestMemoryAttemptStoreBlockKeepsLongerBlock(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryAttemptStore()
+	now := time.Now()
+
+	_, err := store.Increment(ctx, "ip:198.51.100.7", "198.51.100.7", now, now.Add(-time.Minute))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, until := range []time.Time{now.Add(time.Hour), now.Add(time.Minute)} {
+		err = store.Block(ctx, "ip:198.51.100.7", until)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, _ := store.Get(ctx, "ip:198.51.100.7")
+
+	if !info.BlockedUntil.Equal(now.Add(time.Hour)) {
+		t.Errorf("got block until %s, want the longer block until %s", info.BlockedUntil, now.Add(time.Hour))
+	}
+}
+
+func TestAttemptKeys(t *testing.T) {
+	if key := AccountKey(" Ada@Example.COM "); key != "account:ada@example.com" {
+		t.Errorf("AccountKey = %q", key)
+	}
+
+	if key := IPKey("2001:db8::1"); key != "ip:2001:db8::1" {
+		t.Errorf("IPKey = %q", key)
+	}
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters of RFC 6238, they are the defaults every authenticator app understands
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// codes of the previous and next period are accepted as well to tolerate clock drift
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random base32 encoded secret with 160 bits
+func GenerateTOTPSecret() (string, error) {
+	buffer := make([]byte, 20)
+
+	_, err := rand.Read(buffer)
+
+	if err != nil {
+		return "", errors.New("unable to generate totp secret: " + err.Error())
+	}
+
+	return totpEncoding.EncodeToString(buffer), nil
+}
+
+// TOTPProvisioningURI returns the otpauth:// uri authenticator apps scan as QR code
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpCode calculates the HOTP value (RFC 4226) for the given time step
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+
+	if err != nil {
+		return "", errors.New("invalid totp secret: " + err.Error())
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo), nil
+}
+
+/*
+ValidateTOTP checks the code against the current time step and its neighbours.
+Steps up to lastStep were already used and are rejected, so a code can't be replayed.
+The matching step is returned and has to be stored as the new lastStep
+*/
+func ValidateTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+
+		expected, err := totpCode(secret, step)
+
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns codes like "k3j9-x8p2" which can replace a totp code once
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+	codes := make([]string, 0, count)
+
+	for i := 0; i < count; i++ {
+		buffer := make([]byte, 8)
+
+		_, err := rand.Read(buffer)
+
+		if err != nil {
+			return nil, errors.New("unable to generate recovery code: " + err.Error())
+		}
+
+		for j := range buffer {
+			buffer[j] = alphabet[int(buffer[j])%len(alphabet)]
+		}
+
+		codes = append(codes, string(buffer[:4])+"-"+string(buffer[4:]))
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// the SHA1 secret of RFC 6238 appendix B, "12345678901234567890" in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// the RFC lists 8 digit values, the last 6 digits are the codes of this implementation
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := totpCode(rfc6238Secret, test.unix/totpPeriod)
+
+		if err != nil {
+			t.Fatalf("time %d: %v", test.unix, err)
+		}
+
+		if code != test.code {
+			t.Errorf("time %d: got %s, want %s", test.unix, code, test.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	codeOf := func(step int64) string {
+		code, err := totpCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatalf("step %d: %v", step, err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		step     int64
+		valid    bool
+	}{
+		{name: "current step", secret: rfc6238Secret, code: codeOf(current), step: current, valid: true},
+		{name: "previous step within skew", secret: rfc6238Secret, code: codeOf(current - 1), step: current - 1, valid: true},
+		{name: "next step within skew", secret: rfc6238Secret, code: codeOf(current + 1), step: current + 1, valid: true},
+		{name: "step outside skew", secret: rfc6238Secret, code: codeOf(current - 2)},
+		{name: "spaces are ignored", secret: rfc6238Secret, code: codeOf(current)[:3] + " " + codeOf(current)[3:], step: current, valid: true},
+		{name: "lower case secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: codeOf(current), step: current, valid: true},
+		{name: "replayed step", secret: rfc6238Secret, code: codeOf(current), lastStep: current},
+		{name: "older step after newer one was used", secret: rfc6238Secret, code: codeOf(current - 1), lastStep: current},
+		{name: "next step after current was used", secret: rfc6238Secret, code: codeOf(current + 1), lastStep: current, step: current + 1, valid: true},
+		{name: "wrong code", secret: rfc6238Secret, code: "000000"},
+		{name: "too short", secret: rfc6238Secret, code: codeOf(current)[:5]},
+		{name: "too long", secret: rfc6238Secret, code: codeOf(current) + "0"},
+		{name: "invalid secret", secret: "not base32!", code: codeOf(current)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			step, valid := ValidateTOTP(test.secret, test.code, now, test.lastStep)
+
+			if valid != test.valid || step != test.step {
+				t.Errorf("got step %d valid %t, want step %d valid %t", step, valid, test.step, test.valid)
+			}
+		})
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes, want 10", len(codes))
+	}
+
+	format := regexp.MustCompile(`^[a-hjkmnp-z02-9]{4}-[a-hjkmnp-z02-9]{4}$`)
+	seen := map[string]bool{}
+
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Errorf("code %q doesn't match %s", code, format)
+		}
+
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+
+		seen[code] = true
+	}
+}
@@ -1,11 +1,15 @@
 package utils
 
 import (
-	customTypes "backend/src/types"
 	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"io"
-	"sync"
+	"os"
+	"strconv"
 	"time"
 )
 
@@ -27,67 +31,60 @@ func ParseLogs(logs io.Reader) ([]string, error) {
 	return logsArray, nil
 }
 
-const (
-	maxAttempts      = 10
-	maxAttemptsPerIP = 10              // max attempts allowed
-	blockDuration    = 1 * time.Minute // block duration after too many attempts
-	windowDuration   = 1 * time.Minute // time window to reset attempt count
-	cleanupInterval  = 1 * time.Minute // interval for cleanup of expired entries
-)
+// GetEnvDuration reads a duration like "15m" from the environment and falls back to the default
+func GetEnvDuration(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
 
-var loginAttempts = make(map[string]*customTypes.LoginAttemptInfo)
-var mu sync.Mutex
+	if value == "" {
+		return fallback
+	}
 
-var lastCleanup = time.Now()
+	duration, err := time.ParseDuration(value)
 
-func CleanupOldAttempts(now time.Time) {
-	for id, info := range loginAttempts {
-		if now.Sub(info.LastAttempt) > windowDuration {
-			delete(loginAttempts, id)
-		}
+	if err != nil {
+		return fallback
 	}
-	lastCleanup = now
-}
 
-func TrackLoginAttempt(username, ip string) bool {
-	mu.Lock()
-	defer mu.Unlock()
+	return duration
+}
 
-	now := time.Now()
+// GetEnvInt reads a number from the environment and falls back to the default
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
 
-	if now.Sub(lastCleanup) > cleanupInterval {
-		CleanupOldAttempts(now)
+	if err != nil {
+		return fallback
 	}
 
-	info, exists := loginAttempts[username]
-	if !exists {
-		info = &customTypes.LoginAttemptInfo{
-			AttemptCount: 0,
-			LastAttempt:  now,
-			IpAttempts:   make(map[string]int),
-		}
-		loginAttempts[username] = info
-	}
+	return value
+}
 
-	if now.Sub(info.LastAttempt) > windowDuration {
-		info.AttemptCount = 0
-	}
+// GetEnvBool reads "true" or "false" from the environment and falls back to the default
+func GetEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
 
-	if info.BlockedUntil.After(now) {
-		return true
+	if err != nil {
+		return fallback
 	}
 
-	info.AttemptCount++
-	info.LastAttempt = now
+	return value
+}
 
-	info.IpAttempts[ip]++
-	if info.AttemptCount >= maxAttempts {
-		info.BlockedUntil = now.Add(blockDuration)
-	}
+// GenerateToken returns a random url safe token with the given amount of random bytes
+func GenerateToken(size int) (string, error) {
+	buffer := make([]byte, size)
 
-	if info.IpAttempts[ip] >= maxAttemptsPerIP {
-		return true
+	_, err := rand.Read(buffer)
+
+	if err != nil {
+		return "", errors.New("unable to generate random token: " + err.Error())
 	}
 
-	return info.BlockedUntil.After(now)
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// HashToken hashes opaque tokens before they get stored, so a leaked table can't be used to log in
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
 }